@@ -0,0 +1,190 @@
+package ltxref
+
+import (
+	"html/template"
+)
+
+func cloneStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	out := make([]string, len(in))
+	copy(out, in)
+	return out
+}
+
+func cloneModes(in []Mode) []Mode {
+	if in == nil {
+		return nil
+	}
+	out := make([]Mode, len(in))
+	copy(out, in)
+	return out
+}
+
+func cloneExamples(in []*Example) []*Example {
+	if in == nil {
+		return nil
+	}
+	out := make([]*Example, len(in))
+	for i, ex := range in {
+		n := *ex
+		out[i] = &n
+	}
+	return out
+}
+
+func cloneShortDescription(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in))
+	for lang, text := range in {
+		out[lang] = text
+	}
+	return out
+}
+
+func cloneDescription(in map[string]template.HTML) map[string]template.HTML {
+	out := make(map[string]template.HTML, len(in))
+	for lang, text := range in {
+		out[lang] = text
+	}
+	return out
+}
+
+// Clone returns a deep copy of the reference. Changes to the copy do not
+// affect the original.
+func (l *Ltxref) Clone() *Ltxref {
+	c := &Ltxref{Version: l.Version}
+	c.Sources = append(c.Sources, l.Sources...)
+	for _, cmd := range l.Commands {
+		c.Commands = append(c.Commands, cmd.Clone())
+	}
+	for _, env := range l.Environments {
+		c.Environments = append(c.Environments, env.Clone())
+	}
+	for _, dc := range l.DocumentClasses {
+		c.DocumentClasses = append(c.DocumentClasses, dc.Clone())
+	}
+	for _, pkg := range l.Packages {
+		c.Packages = append(c.Packages, pkg.Clone())
+	}
+	return c
+}
+
+func (c *Command) Clone() *Command {
+	n := *c
+	n.Label = cloneStrings(c.Label)
+	n.ShortDescription = cloneShortDescription(c.ShortDescription)
+	n.Description = cloneDescription(c.Description)
+	n.Variant = cloneVariants(c.Variant)
+	n.Examples = cloneExamples(c.Examples)
+	n.Modes = cloneModes(c.Modes)
+	n.Parents = cloneStrings(c.Parents)
+	n.SeeAlso = cloneStrings(c.SeeAlso)
+	return &n
+}
+
+func (e *Environment) Clone() *Environment {
+	n := *e
+	n.Label = cloneStrings(e.Label)
+	n.ShortDescription = cloneShortDescription(e.ShortDescription)
+	n.Description = cloneDescription(e.Description)
+	n.Variant = cloneVariants(e.Variant)
+	n.Examples = cloneExamples(e.Examples)
+	n.Modes = cloneModes(e.Modes)
+	n.Parents = cloneStrings(e.Parents)
+	n.SeeAlso = cloneStrings(e.SeeAlso)
+	return &n
+}
+
+func (dc *DocumentClass) Clone() *DocumentClass {
+	n := *dc
+	n.Label = cloneStrings(dc.Label)
+	n.ShortDescription = cloneShortDescription(dc.ShortDescription)
+	n.Description = cloneDescription(dc.Description)
+	n.Optiongroup = nil
+	for _, og := range dc.Optiongroup {
+		n.Optiongroup = append(n.Optiongroup, og.Clone())
+	}
+	return &n
+}
+
+func (og *Optiongroup) Clone() *Optiongroup {
+	n := *og
+	n.ShortDescription = cloneShortDescription(og.ShortDescription)
+	n.Classoption = nil
+	for _, co := range og.Classoption {
+		n.Classoption = append(n.Classoption, co.Clone())
+	}
+	return &n
+}
+
+func (co *Classoption) Clone() *Classoption {
+	n := *co
+	n.ShortDescription = cloneShortDescription(co.ShortDescription)
+	n.Values = cloneStrings(co.Values)
+	return &n
+}
+
+func (p *Package) Clone() *Package {
+	n := *p
+	n.Label = cloneStrings(p.Label)
+	n.LoadsPackages = cloneStrings(p.LoadsPackages)
+	n.ShortDescription = cloneShortDescription(p.ShortDescription)
+	n.Description = cloneDescription(p.Description)
+	n.Examples = cloneExamples(p.Examples)
+	n.Commands = nil
+	for _, cmd := range p.Commands {
+		n.Commands = append(n.Commands, cmd.Clone())
+	}
+	n.Options = nil
+	for _, po := range p.Options {
+		n.Options = append(n.Options, po.Clone())
+	}
+	return &n
+}
+
+func (po *Packageoption) Clone() *Packageoption {
+	n := *po
+	n.ShortDescription = cloneShortDescription(po.ShortDescription)
+	n.Values = cloneStrings(po.Values)
+	return &n
+}
+
+func cloneVariants(in []Variant) []Variant {
+	if in == nil {
+		return nil
+	}
+	out := make([]Variant, len(in))
+	for i, v := range in {
+		out[i] = v.Clone()
+	}
+	return out
+}
+
+func (v Variant) Clone() Variant {
+	n := v
+	n.Description = cloneDescription(v.Description)
+	n.Examples = cloneExamples(v.Examples)
+	n.Arguments = nil
+	for _, arg := range v.Arguments {
+		n.Arguments = append(n.Arguments, arg.Clone())
+	}
+	return n
+}
+
+func (a *Argument) Clone() *Argument {
+	n := *a
+	n.Description = cloneDescription(a.Description)
+	n.Keys = nil
+	for _, key := range a.Keys {
+		n.Keys = append(n.Keys, key.Clone())
+	}
+	return &n
+}
+
+func (k *Key) Clone() *Key {
+	n := *k
+	n.Choices = cloneStrings(k.Choices)
+	n.Description = cloneDescription(k.Description)
+	return &n
+}
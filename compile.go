@@ -0,0 +1,152 @@
+package ltxref
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNoEngine is returned by CheckExamples if the TeX engine is not
+// installed. Tests should skip in this case.
+var ErrNoEngine = errors.New("TeX engine not found")
+
+// CompileOptions configures CheckExamples. The zero value runs pdflatex with
+// a timeout of 30 seconds.
+type CompileOptions struct {
+	// The engine such as pdflatex or lualatex, a name in $PATH or a path
+	Engine string
+	// The time limit for one example
+	Timeout time.Duration
+	// The document class for examples without \documentclass. If empty,
+	// article is used if the reference has it, otherwise the first class of
+	// the reference.
+	Class string
+	// The number of log lines reported after the first error (default 10)
+	LogLines int
+}
+
+// A CompileResult is the outcome of compiling one example. Err is nil if the
+// example compiles.
+type CompileResult struct {
+	ExampleFile
+	Err error
+	// The part of the LaTeX log starting with the first error or the end
+	// of the log if there is no error message
+	Log string
+}
+
+func (cr CompileResult) String() string {
+	if cr.Err == nil {
+		return cr.Name + ": ok"
+	}
+	return fmt.Sprintf("%s (%s %s): %s\n%s", cr.Name, cr.Kind, cr.Entry, cr.Err, cr.Log)
+}
+
+// CheckExamples compiles every example of the reference as a standalone
+// document (see ExampleFile.Document) in a temporary directory and returns
+// one result per example. If the engine is not installed, ErrNoEngine is
+// returned.
+func (l *Ltxref) CheckExamples(opts CompileOptions) ([]CompileResult, error) {
+	if opts.Engine == "" {
+		opts.Engine = "pdflatex"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.LogLines == 0 {
+		opts.LogLines = 10
+	}
+	if opts.Class == "" {
+		opts.Class = l.exampleClass()
+	}
+	engine, err := exec.LookPath(opts.Engine)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opts.Engine, ErrNoEngine)
+	}
+	dir, err := os.MkdirTemp("", "ltxref-examples")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var results []CompileResult
+	for _, ef := range l.Examples() {
+		cr := CompileResult{ExampleFile: ef}
+		cr.Log, cr.Err = compileExample(engine, filepath.Join(dir, strings.TrimSuffix(ef.Name, ".tex")), ef.Document(opts.Class), opts)
+		results = append(results, cr)
+	}
+	return results, nil
+}
+
+// exampleClass returns the document class for examples without
+// \documentclass.
+func (l *Ltxref) exampleClass() string {
+	if l.GetDocumentClass("article") != nil || len(l.DocumentClasses) == 0 {
+		return "article"
+	}
+	return l.DocumentClasses[0].Name
+}
+
+// compileExample runs the engine on the document in its own directory dir
+// and returns the log excerpt and the error.
+func compileExample(engine string, dir string, document string, opts CompileOptions) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "example.tex"), []byte(document), 0644); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, engine, "-interaction=nonstopmode", "-halt-on-error", "-no-shell-escape", "example.tex")
+	cmd.Dir = dir
+	// do not wait for processes started by the engine after a timeout
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return "", nil
+	}
+	log, logerr := os.ReadFile(filepath.Join(dir, "example.log"))
+	if logerr != nil {
+		log = output
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timeout after %s", opts.Timeout)
+	} else {
+		err = fmt.Errorf("%s: %w", filepath.Base(engine), err)
+	}
+	return logExcerpt(log, opts.LogLines), err
+}
+
+// logExcerpt returns n lines of the log starting with the first error
+// message (a line starting with !) or the last n lines if there is none.
+func logExcerpt(log []byte, n int) string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(log))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	start := len(lines) - n
+	for i, line := range lines {
+		if strings.HasPrefix(line, "!") {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + n
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return strings.Join(lines[start:end], "\n")
+}
@@ -0,0 +1,48 @@
+package ltxref
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckExamples(t *testing.T) {
+	l := &Ltxref{}
+	cmd, err := l.AddCommand(`\textbf`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Examples = []*Example{{Source: `\textbf{bold}`}}
+	results, err := l.CheckExamples(CompileOptions{})
+	if errors.Is(err, ErrNoEngine) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	if results[0].Err != nil {
+		t.Error(results[0])
+	}
+}
+
+func TestLogExcerpt(t *testing.T) {
+	log := "This is pdfTeX\nline 2\n! Undefined control sequence.\nl.4 \\foo\n\nline 6\nline 7\n"
+	tests := []struct {
+		log  string
+		n    int
+		want string
+	}{
+		{log, 2, "! Undefined control sequence.\nl.4 \\foo"},
+		{log, 10, "! Undefined control sequence.\nl.4 \\foo\n\nline 6\nline 7"},
+		{"a\nb\nc\nd\n", 2, "c\nd"},
+		{"a\nb\n", 5, "a\nb"},
+		{"", 3, ""},
+	}
+	for _, tt := range tests {
+		if got := logExcerpt([]byte(tt.log), tt.n); got != tt.want {
+			t.Errorf("logExcerpt(%q, %d) = %q, want %q", tt.log, tt.n, got, tt.want)
+		}
+	}
+}
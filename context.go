@@ -0,0 +1,340 @@
+package ltxref
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Context is a position in a LaTeX document: the mode and the open
+// environments, the innermost last.
+type Context struct {
+	Mode         Mode
+	Environments []string
+}
+
+// contextProblem returns why an entry with the modes and parents cannot be
+// used in the context or the empty string. Entries for text mode can be used
+// in vertical mode as well, because they start a new paragraph. Everything
+// is allowed in the preamble, where commands are used in definitions such as
+// \newcommand{\half}{\frac{1}{2}} and in arguments such as \title{...}, so
+// only preamble commands used in the document are reported.
+func contextProblem(modes []Mode, parents []string, ctx Context) string {
+	if ctx.Mode == PREAMBLEMODE {
+		return ""
+	}
+	if len(modes) > 0 {
+		ok := false
+		for _, m := range modes {
+			if m == ctx.Mode || m == TEXTMODE && ctx.Mode == VERTICALMODE {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Sprintf("not allowed in %s mode", ctx.Mode)
+		}
+	}
+	if len(parents) > 0 {
+		if len(ctx.Environments) == 0 || !hasTag(parents, ctx.Environments[len(ctx.Environments)-1]) {
+			return "only allowed in " + strings.Join(parents, ", ")
+		}
+	}
+	return ""
+}
+
+// ValidIn returns true if the command can be used in the context.
+func (c *Command) ValidIn(ctx Context) bool {
+	return contextProblem(c.Modes, c.Parents, ctx) == ""
+}
+
+// ValidIn returns true if the environment can be started in the context.
+func (e *Environment) ValidIn(ctx Context) bool {
+	return contextProblem(e.Modes, e.Parents, ctx) == ""
+}
+
+// InContext returns the commands that can be used in the context, for
+// example l.FilterCommands("fr", "", EXPERT).InContext(l.ContextAt(src, pos)).
+func (slice Commands) InContext(ctx Context) Commands {
+	var ret Commands
+	for _, cmd := range slice {
+		if cmd.ValidIn(ctx) {
+			ret = append(ret, cmd)
+		}
+	}
+	return ret
+}
+
+// InContext returns the environments that can be started in the context.
+func (slice Environments) InContext(ctx Context) Environments {
+	var ret Environments
+	for _, env := range slice {
+		if env.ValidIn(ctx) {
+			ret = append(ret, env)
+		}
+	}
+	return ret
+}
+
+// ContextAt returns the context at the byte offset pos of the LaTeX document
+// src. Everything before \begin{document} is the preamble (a document
+// without \begin{document} has none). Math mode is entered with $, $$, \(,
+// \[ and environments with the label math. The argument of a text box such
+// as \text or \mbox is in text mode again. A paragraph ends at an empty line,
+// \par and at the start and end of an environment.
+func (l *Ltxref) ContextAt(src string, pos int) Context {
+	ct := newContextTracker(l, src)
+	return ct.at(pos)
+}
+
+// textBoxes are the commands whose first mandatory argument is typeset in
+// text mode, even if the command is used in math mode.
+var textBoxes = map[string]bool{
+	`\text`:            true,
+	`\mbox`:            true,
+	`\hbox`:            true,
+	`\fbox`:            true,
+	`\makebox`:         true,
+	`\framebox`:        true,
+	`\textrm`:          true,
+	`\textsf`:          true,
+	`\texttt`:          true,
+	`\textnormal`:      true,
+	`\textup`:          true,
+	`\textit`:          true,
+	`\textsl`:          true,
+	`\textsc`:          true,
+	`\textbf`:          true,
+	`\textmd`:          true,
+	`\emph`:            true,
+	`\intertext`:       true,
+	`\shortintertext`:  true,
+	`\textsuperscript`: true,
+	`\textsubscript`:   true,
+}
+
+// contextGroup is an open brace group. The mode is restored when a text box
+// argument ends.
+type contextGroup struct {
+	textbox bool
+	math    string
+	inText  bool
+}
+
+// contextTracker follows the mode and the environments through a document.
+type contextTracker struct {
+	l   *Ltxref
+	src string
+	pos int
+	// before \begin{document}
+	preamble bool
+	// inside a paragraph
+	paragraph bool
+	// the closing delimiter of the current inline or display math
+	math    string
+	envs    []string
+	envMath []bool
+	// inside the argument of a text box in math mode
+	inText bool
+	// the next brace group is the argument of a text box
+	textArg bool
+	groups  []contextGroup
+}
+
+func newContextTracker(l *Ltxref, src string) *contextTracker {
+	return &contextTracker{l: l, src: src, preamble: strings.Contains(src, `\begin{document}`)}
+}
+
+// at returns the context at pos. pos must not be smaller than in the
+// previous call.
+func (ct *contextTracker) at(pos int) Context {
+	if pos > len(ct.src) {
+		pos = len(ct.src)
+	}
+	for ct.pos < pos {
+		ct.step()
+	}
+	ctx := Context{Mode: TEXTMODE, Environments: append([]string{}, ct.envs...)}
+	switch {
+	case ct.preamble:
+		ctx.Mode = PREAMBLEMODE
+	case ct.math != "":
+		ctx.Mode = MATHMODE
+	case ct.inText:
+		// the argument of a text box
+	case hasMathEnvironment(ct.envMath):
+		ctx.Mode = MATHMODE
+	case !ct.paragraph:
+		ctx.Mode = VERTICALMODE
+	}
+	return ctx
+}
+
+func hasMathEnvironment(envMath []bool) bool {
+	for _, m := range envMath {
+		if m {
+			return true
+		}
+	}
+	return false
+}
+
+// step reads the next token.
+func (ct *contextTracker) step() {
+	src := ct.src
+	switch c := src[ct.pos]; c {
+	case '%':
+		if i := strings.IndexByte(src[ct.pos:], '\n'); i >= 0 {
+			ct.pos += i
+		} else {
+			ct.pos = len(src)
+		}
+	case '\n':
+		ct.pos++
+		rest := strings.TrimLeft(src[ct.pos:], " \t")
+		if strings.HasPrefix(rest, "\n") {
+			ct.paragraph = false
+		}
+	case ' ', '\t':
+		ct.pos++
+	case '{':
+		ct.pos++
+		g := contextGroup{textbox: ct.textArg, math: ct.math, inText: ct.inText}
+		ct.groups = append(ct.groups, g)
+		if ct.textArg {
+			ct.math = ""
+			ct.inText = true
+			ct.textArg = false
+		}
+	case '}':
+		ct.pos++
+		if n := len(ct.groups); n > 0 {
+			g := ct.groups[n-1]
+			ct.groups = ct.groups[:n-1]
+			if g.textbox {
+				ct.math = g.math
+				ct.inText = g.inText
+			}
+		}
+	case '$':
+		delim := "$"
+		if strings.HasPrefix(src[ct.pos:], "$$") {
+			delim = "$$"
+		}
+		ct.pos += len(delim)
+		ct.toggleMath(delim, delim)
+	case '\\':
+		name := cwlCommandName(src[ct.pos:])
+		ct.pos += len(name)
+		switch name {
+		case `\(`:
+			ct.toggleMath(name, `\)`)
+		case `\[`:
+			ct.toggleMath(name, `\]`)
+		case `\)`, `\]`:
+			// a closing delimiter never starts math mode
+			if ct.math == name {
+				ct.math = ""
+			}
+		case `\par`:
+			ct.paragraph = false
+		case `\begin`, `\end`:
+			ct.environment(name)
+		default:
+			if textBoxes[name] && (ct.math != "" || !ct.inText && hasMathEnvironment(ct.envMath)) {
+				ct.textBox()
+				return
+			}
+			if len(name) == 2 && !isLetter(name[1]) && name != `\\` && !ct.preamble {
+				// escaped character such as \$
+				ct.paragraph = true
+			}
+		}
+	default:
+		ct.pos++
+		if !ct.preamble {
+			ct.paragraph = true
+		}
+	}
+}
+
+// textBox skips the optional arguments of a text box, so that the next
+// brace group is read as its text argument.
+func (ct *contextTracker) textBox() {
+	for {
+		rest := strings.TrimLeft(ct.src[ct.pos:], " \t\n")
+		if strings.HasPrefix(rest, "{") {
+			ct.pos = len(ct.src) - len(rest)
+			ct.textArg = true
+			return
+		}
+		if !strings.HasPrefix(rest, "[") {
+			return
+		}
+		end := matchingBracket(rest)
+		if end < 0 {
+			return
+		}
+		ct.pos = len(ct.src) - len(rest) + end + 1
+	}
+}
+
+// toggleMath starts math mode with the closing delimiter or ends math mode
+// if delim is the current closing delimiter.
+func (ct *contextTracker) toggleMath(delim string, closing string) {
+	switch {
+	case ct.math == "":
+		ct.math = closing
+		if !ct.preamble && closing == "$" {
+			ct.paragraph = true
+		}
+	case ct.math == delim:
+		ct.math = ""
+	}
+}
+
+// environment reads the name after \begin or \end and updates the stack of
+// environments.
+func (ct *contextTracker) environment(cs string) {
+	rest := strings.TrimLeft(ct.src[ct.pos:], " \t\n")
+	if !strings.HasPrefix(rest, "{") {
+		return
+	}
+	i := strings.IndexByte(rest, '}')
+	if i < 0 {
+		return
+	}
+	ct.pos = len(ct.src) - len(rest) + i + 1
+	name := strings.TrimSpace(rest[1:i])
+	if name == "document" {
+		ct.preamble = cs == `\end`
+		ct.paragraph = false
+		return
+	}
+	if cs == `\begin` {
+		ismath := false
+		env := ct.l.GetEnvironmentWithName(name)
+		if env == nil {
+			env = ct.l.GetEnvironmentWithName(strings.TrimSuffix(name, "*"))
+		}
+		if env != nil {
+			ismath = hasTag(env.Label, "math")
+		}
+		ct.envs = append(ct.envs, name)
+		ct.envMath = append(ct.envMath, ismath)
+		if !ismath && ct.math == "" {
+			ct.paragraph = false
+		}
+		return
+	}
+	for j := len(ct.envs) - 1; j >= 0; j-- {
+		if ct.envs[j] == name {
+			ismath := ct.envMath[j]
+			ct.envs = ct.envs[:j]
+			ct.envMath = ct.envMath[:j]
+			if !ismath && ct.math == "" {
+				ct.paragraph = false
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ltxref
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContextAt(t *testing.T) {
+	l := &Ltxref{}
+	for _, name := range []string{"itemize", "enumerate", "align", "equation"} {
+		env, err := l.AddEnvironment(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "align" || name == "equation" {
+			env.Label = []string{"math"}
+		}
+	}
+	// | marks the position
+	tests := []struct {
+		src  string
+		mode Mode
+		envs string
+	}{
+		{`\documentclass{article}|\begin{document}x\end{document}`, PREAMBLEMODE, ""},
+		{`\documentclass{article}\begin{document}|\end{document}`, VERTICALMODE, ""},
+		{`\begin{document}Hello |world\end{document}`, TEXTMODE, ""},
+		{"Hello\n\n|", VERTICALMODE, ""},
+		{"Hello\n\\par|", VERTICALMODE, ""},
+		{"% Hello $x\n|", VERTICALMODE, ""},
+		{`Hello $x|$`, MATHMODE, ""},
+		{`Hello $x$ |`, TEXTMODE, ""},
+		{`Hello $$x|$$`, MATHMODE, ""},
+		{`Hello \(x|\)`, MATHMODE, ""},
+		{`Hello \[ x| \]`, MATHMODE, ""},
+		{`Hello \[ x \] b|`, TEXTMODE, ""},
+		{`Hello \$ b|`, TEXTMODE, ""},
+		{`\begin{equation} x| \end{equation}`, MATHMODE, "equation"},
+		{`\begin{align*} x|`, MATHMODE, "align*"},
+		{`\begin{align} x \end{align}|`, TEXTMODE, ""},
+		{`\begin{itemize}|`, VERTICALMODE, "itemize"},
+		{`\begin{itemize}\item a \begin{enumerate}\item b|`, TEXTMODE, "itemize enumerate"},
+		{`\begin{itemize}\item a \begin{enumerate}\item b\end{enumerate}|`, VERTICALMODE, "itemize"},
+		{`\begin{itemize}\item $x|$`, MATHMODE, "itemize"},
+		// text boxes in math mode
+		{`$x = \text{\textbf{a|}}$`, TEXTMODE, ""},
+		{`$x = \text{\textbf{a}}|$`, MATHMODE, ""},
+		{`$x = \text{a $b|$}$`, MATHMODE, ""},
+		{`$x = \text{a $b$ c|}$`, TEXTMODE, ""},
+		{`$\mbox{a} {b}|$`, MATHMODE, ""},
+		{`$\makebox[1cm][l]{a|}$`, TEXTMODE, ""},
+		{`\begin{align} x \intertext{and|} y \end{align}`, TEXTMODE, "align"},
+		{`\begin{align} x \intertext{and} y| \end{align}`, MATHMODE, "align"},
+		{`\[ \text{a} \frac{1}{2}| \]`, MATHMODE, ""},
+		// closing delimiters do not start math mode
+		{"\\)\n\n|", VERTICALMODE, ""},
+		{`a \] b|`, TEXTMODE, ""},
+		{`a \) b $x|$`, MATHMODE, ""},
+		{`$x \] y|$`, MATHMODE, ""},
+	}
+	for _, tt := range tests {
+		pos := strings.Index(tt.src, "|")
+		src := tt.src[:pos] + tt.src[pos+1:]
+		ctx := l.ContextAt(src, pos)
+		if ctx.Mode != tt.mode || strings.Join(ctx.Environments, " ") != tt.envs {
+			t.Errorf("%q: got %s mode in %q, want %s mode in %q", tt.src, ctx.Mode, strings.Join(ctx.Environments, " "), tt.mode, tt.envs)
+		}
+	}
+}
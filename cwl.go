@@ -0,0 +1,212 @@
+package ltxref
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cwlArgument returns the argument in TeXstudio's completion word list
+// syntax: {name} for mandatory and [name] for optional arguments.
+func cwlArgument(a *Argument) string {
+	switch a.Type {
+	case OPTARG, OPTLIST:
+		return "[" + a.Name + "]"
+	case MANDARG, MANDLIST:
+		return "{" + a.Name + "}"
+	case KEYVALLIST:
+		if !a.Optional {
+			return "{" + a.Name + "%keyvals}"
+		}
+		return "[" + a.Name + "%keyvals]"
+	case TODIMENORSPREADDIMEN:
+		return " to %<" + a.Name + "%>"
+	case STAR:
+		return "*"
+	case TOKEN:
+		return a.Delimiters
+	case DELIMITED:
+		open, closing := splitDelimiters(a.Delimiters)
+		return open + a.Name + closing
+	case VERBATIM:
+		return "|%<" + a.Name + "%>|"
+	case EMBELLISHMENT:
+		return a.Delimiters + "{" + a.Name + "}"
+	case BODY:
+		return ""
+	}
+	return "%<" + a.Name + "%>"
+}
+
+// cwlClassifier returns the classifier appended to a command line. Entries
+// with the label math and commands for math mode only are only available in
+// math mode, commands for the preamble only are marked with p and entries
+// above the intermediate level are marked as unusual.
+func cwlClassifier(labels []string, modes []Mode, level Level, env bool) string {
+	c := ""
+	switch {
+	case env && hasTag(labels, "math"):
+		c = `\math`
+	case env:
+	case hasTag(labels, "math") || len(modes) == 1 && modes[0] == MATHMODE:
+		c = "m"
+	case len(modes) == 1 && modes[0] == PREAMBLEMODE:
+		c = "p"
+	}
+	if level > INTERMEDIATE {
+		c += "*"
+	}
+	if c == "" {
+		return ""
+	}
+	return "#" + c
+}
+
+// cwlOptionValue returns the value part of a key value entry: #a,b for a
+// choice, ##L for a dimension and %<value%> for other values.
+func cwlOptionValue(ov OptionValue) string {
+	switch {
+	case ov.Kind == CHOICEOPTION || ov.Kind == KEYVALOPTION && len(ov.Values) > 0:
+		return "=#" + strings.Join(ov.Values, ",")
+	case ov.Kind == KEYVALOPTION && ov.Type == DIMENSIONVALUE:
+		return "=##L"
+	case ov.Kind == KEYVALOPTION:
+		return "=%<" + ov.Type.String() + "%>"
+	}
+	return ""
+}
+
+func writeCWLCommand(w *bufio.Writer, cmd *Command) {
+	class := cwlClassifier(cmd.Label, cmd.Modes, cmd.Level, false)
+	if len(cmd.Variant) == 0 {
+		fmt.Fprintf(w, "%s%s\n", cmd.Name, class)
+		return
+	}
+	for _, v := range cmd.Variant {
+		// TeXstudio has no optional star or token, so these variants get a
+		// line with and a line without them.
+		var full, short strings.Builder
+		full.WriteString(v.Name)
+		short.WriteString(v.Name)
+		for _, arg := range v.Arguments {
+			full.WriteString(cwlArgument(arg))
+			if arg.Type != STAR && arg.Type != TOKEN {
+				short.WriteString(cwlArgument(arg))
+			}
+		}
+		if short.String() != full.String() {
+			fmt.Fprintf(w, "%s%s\n", short.String(), class)
+		}
+		fmt.Fprintf(w, "%s%s\n", full.String(), class)
+	}
+}
+
+func writeCWLEnvironment(w *bufio.Writer, env *Environment) {
+	class := cwlClassifier(env.Label, nil, env.Level, true)
+	variants := env.Variant
+	if len(variants) == 0 {
+		variants = []Variant{{Name: env.Name}}
+	}
+	for _, v := range variants {
+		fmt.Fprintf(w, `\begin{%s}`, env.Name)
+		for _, arg := range v.Arguments {
+			w.WriteString(cwlArgument(arg))
+		}
+		fmt.Fprintf(w, "%s\n", class)
+	}
+	fmt.Fprintf(w, "\\end{%s}\n", env.Name)
+}
+
+// WriteCWL writes the package as a TeXstudio completion word list
+// (package.cwl). Each variant of a command becomes one line, the packages
+// loaded by this package are included and the package options are listed as
+// key values for \usepackage.
+func (p *Package) WriteCWL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s package\n", p.Name)
+	if s := p.ShortDescription["en"]; s != "" {
+		fmt.Fprintf(bw, "# %s\n", s)
+	}
+	bw.WriteString("# generated by ltxref\n\n")
+	for _, name := range p.LoadsPackages {
+		if name != "" {
+			fmt.Fprintf(bw, "#include:%s\n", name)
+		}
+	}
+	if len(p.LoadsPackages) > 0 {
+		bw.WriteString("\n")
+	}
+	if len(p.Options) > 0 {
+		fmt.Fprintf(bw, "#keyvals:\\usepackage/%s#c\n", p.Name)
+		for _, po := range p.Options {
+			fmt.Fprintln(bw, po.Name+cwlOptionValue(po.OptionValue))
+		}
+		bw.WriteString("#endkeyvals\n\n")
+	}
+	for _, cmd := range p.Commands {
+		writeCWLCommand(bw, cmd)
+	}
+	return bw.Flush()
+}
+
+// WriteKernelCWL writes the kernel commands and the environments as a
+// TeXstudio completion word list (latex-document.cwl).
+func (l *Ltxref) WriteKernelCWL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# LaTeX kernel commands and environments\n")
+	bw.WriteString("# generated by ltxref\n\n")
+	for _, cmd := range l.Commands {
+		writeCWLCommand(bw, cmd)
+	}
+	bw.WriteString("\n")
+	for _, env := range l.Environments {
+		writeCWLEnvironment(bw, env)
+	}
+	return bw.Flush()
+}
+
+// WriteCWLFiles writes latex-document.cwl and one package.cwl for each
+// package into dir. The file names must match the package names, so an error
+// is returned for a package name that is not a plain file name.
+func (l *Ltxref) WriteCWLFiles(dir string) error {
+	for _, pkg := range l.Packages {
+		if err := checkCWLFileName(pkg.Name); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	write := func(filename string, fn func(io.Writer) error) error {
+		f, err := os.Create(filepath.Join(dir, filename))
+		if err != nil {
+			return err
+		}
+		if err = fn(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	if err := write("latex-document.cwl", l.WriteKernelCWL); err != nil {
+		return err
+	}
+	for _, pkg := range l.Packages {
+		if err := write(pkg.Name+".cwl", pkg.WriteCWL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCWLFileName makes sure that the package name can be used as a file
+// name in the CWL directory.
+func checkCWLFileName(name string) error {
+	if name == "" || name == "latex-document" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\:`) {
+		return fmt.Errorf("package %q: not usable as a cwl file name: %w", name, ErrInvalidName)
+	}
+	return nil
+}
@@ -0,0 +1,501 @@
+package ltxref
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A CWLProblem is a line of a completion word list that could not be
+// interpreted.
+type CWLProblem struct {
+	Line   int
+	Text   string
+	Reason string
+}
+
+func (p CWLProblem) String() string {
+	return fmt.Sprintf("line %d: %s: %q", p.Line, p.Reason, p.Text)
+}
+
+// cwlReader collects the entries of one completion word list. If pkg is nil
+// the entries are kernel commands.
+type cwlReader struct {
+	l        *Ltxref
+	pkg      *Package
+	problems []CWLProblem
+}
+
+// ReadCWL reads a TeXstudio completion word list. The commands are added to
+// the package pkg, or to the kernel commands if pkg is empty or
+// latex-document. Lines that cannot be interpreted are returned as problems.
+func ReadCWL(r io.Reader, pkg string) (*Ltxref, []CWLProblem, error) {
+	cr := &cwlReader{l: &Ltxref{}}
+	if pkg != "" && pkg != "latex-document" {
+		p, err := cr.l.AddPackage(pkg)
+		if err != nil {
+			return nil, nil, err
+		}
+		cr.pkg = p
+	}
+	if err := cr.read(r); err != nil {
+		return nil, nil, err
+	}
+	return cr.l, cr.problems, nil
+}
+
+// ImportCWL reads a completion word list and adds the entries to l. Existing
+// entries keep their descriptions, level and variants, only missing variants,
+// labels, included packages and options are added.
+func (l *Ltxref) ImportCWL(r io.Reader, pkg string) ([]CWLProblem, error) {
+	imported, problems, err := ReadCWL(r, pkg)
+	if err != nil {
+		return nil, err
+	}
+	l.importEntries(imported)
+	return problems, nil
+}
+
+// ImportCWLFile imports the completion word list filename. The package name
+// is the base name of the file without the .cwl extension.
+func (l *Ltxref) ImportCWLFile(filename string) ([]CWLProblem, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pkg := strings.TrimSuffix(filepath.Base(filename), ".cwl")
+	imported, problems, err := ReadCWL(f, pkg)
+	if err != nil {
+		return nil, err
+	}
+	imported.setOrigin(filename)
+	l.importEntries(imported)
+	return problems, nil
+}
+
+func (cr *cwlReader) problem(lineno int, line string, reason string) {
+	cr.problems = append(cr.problems, CWLProblem{Line: lineno, Text: line, Reason: reason})
+}
+
+func (cr *cwlReader) read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	keyvals := ""
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if keyvals != "" {
+			if strings.HasPrefix(line, "#endkeyvals") {
+				keyvals = ""
+			} else if line != "" && !strings.HasPrefix(line, "#") {
+				cr.keyval(keyvals, line)
+			}
+			continue
+		}
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#include:"):
+			if cr.pkg != nil {
+				name := strings.TrimSpace(strings.TrimPrefix(line, "#include:"))
+				if !hasTag(cr.pkg.LoadsPackages, name) {
+					cr.pkg.LoadsPackages = append(cr.pkg.LoadsPackages, name)
+				}
+			}
+		case strings.HasPrefix(line, "#keyvals:"):
+			keyvals = strings.TrimPrefix(line, "#keyvals:")
+		case strings.HasPrefix(line, "#"):
+			// comment or a directive such as #ifOption
+		case strings.HasPrefix(line, `\end{`):
+			// the \begin line is enough
+		case strings.HasPrefix(line, `\begin{`):
+			if err := cr.environment(line); err != nil {
+				cr.problem(lineno, line, err.Error())
+			}
+		case strings.HasPrefix(line, `\`):
+			if err := cr.command(line); err != nil {
+				cr.problem(lineno, line, err.Error())
+			}
+		default:
+			cr.problem(lineno, line, "not a command")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if cr.pkg != nil {
+		sort.Sort(cr.pkg.Commands)
+	}
+	sort.Sort(cr.l.Commands)
+	sort.Sort(cr.l.Environments)
+	return nil
+}
+
+// keyval adds a package option from a #keyvals:\usepackage/pkg block, such
+// as draft, margin=##L or paper=#a4paper,letterpaper. Other key value lists
+// are not part of the model.
+func (cr *cwlReader) keyval(block string, line string) {
+	if cr.pkg == nil {
+		return
+	}
+	if i := strings.Index(block, "#"); i >= 0 {
+		block = block[:i]
+	}
+	if block != `\usepackage/`+cr.pkg.Name {
+		return
+	}
+	name, value := line, ""
+	if i := strings.Index(name, "="); i >= 0 {
+		name, value = name[:i], name[i+1:]
+	}
+	for _, po := range cr.pkg.Options {
+		if po.Name == name {
+			return
+		}
+	}
+	po := NewPackageOption()
+	po.Name = name
+	switch {
+	case strings.HasPrefix(value, "##L"):
+		po.Kind = KEYVALOPTION
+		po.Type = DIMENSIONVALUE
+	case strings.HasPrefix(value, "#"):
+		// paper=#a4paper,letterpaper
+		po.Kind = CHOICEOPTION
+		po.Values = strings.Split(value[1:], ",")
+	case value == "true" || value == "false":
+		po.Kind = CHOICEOPTION
+		po.Values = []string{"true", "false"}
+	case value != "":
+		po.Kind = KEYVALOPTION
+	}
+	cr.pkg.Options = append(cr.pkg.Options, po)
+}
+
+func (cr *cwlReader) command(line string) error {
+	name := cwlCommandName(line)
+	args, classifier, err := parseCWLArguments(line[len(name):])
+	if err != nil {
+		return err
+	}
+	basename := strings.TrimSuffix(name, "*")
+	if basename == `\` {
+		basename = name
+	}
+	var cmds *Commands
+	if cr.pkg != nil {
+		cmds = &cr.pkg.Commands
+	} else {
+		cmds = &cr.l.Commands
+	}
+	var cmd *Command
+	if i := commandIndex(*cmds, basename); i >= 0 {
+		cmd = (*cmds)[i]
+	} else {
+		cmd = NewCommand()
+		cmd.Name = basename
+		*cmds = append(*cmds, cmd)
+	}
+	cmd.Label, cmd.Level = applyCWLClassifier(classifier, cmd.Label, cmd.Level, false)
+	if len(cmd.Modes) == 0 {
+		cmd.Modes = cwlModes(classifier)
+	}
+	if len(cmd.Parents) == 0 {
+		cmd.Parents = cwlParents(classifier)
+	}
+	cmd.Variant = addCWLVariant(cmd.Variant, name, args)
+	return nil
+}
+
+func (cr *cwlReader) environment(line string) error {
+	end := strings.Index(line, "}")
+	if end < 0 {
+		return fmt.Errorf("missing } in environment name")
+	}
+	name := line[len(`\begin{`):end]
+	if err := checkEnvironmentName(name); err != nil {
+		return err
+	}
+	args, classifier, err := parseCWLArguments(line[end+1:])
+	if err != nil {
+		return err
+	}
+	var env *Environment
+	if i := environmentIndex(cr.l.Environments, name); i >= 0 {
+		env = cr.l.Environments[i]
+	} else {
+		env = NewEnvironment()
+		env.Name = name
+		cr.l.Environments = append(cr.l.Environments, env)
+	}
+	env.Label, env.Level = applyCWLClassifier(classifier, env.Label, env.Level, true)
+	env.Variant = addCWLVariant(env.Variant, name, args)
+	return nil
+}
+
+// cwlCommandName returns the command name at the start of line, including a
+// trailing star.
+func cwlCommandName(line string) string {
+	i := 1
+	for i < len(line) && (isLetter(line[i]) || line[i] == '@') {
+		i++
+	}
+	if i == 1 && i < len(line) {
+		// control symbol such as \\ or \[
+		i++
+	}
+	if i > 1 && i < len(line) && line[i] == '*' {
+		i++
+	}
+	return line[:i]
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+var cwlClosing = map[byte]byte{'{': '}', '[': ']', '<': '>', '(': ')'}
+
+// parseCWLArguments parses the placeholders after a command name and returns
+// the arguments and the classifier after the #.
+func parseCWLArguments(s string) ([]*Argument, string, error) {
+	args := []*Argument{}
+	for len(s) > 0 {
+		switch {
+		case s[0] == ' ':
+			if strings.HasPrefix(s, " to %<") {
+				end := strings.Index(s, "%>")
+				if end < 0 {
+					return nil, "", fmt.Errorf("missing %%> in placeholder")
+				}
+				args = append(args, &Argument{Name: cwlPlaceholderName(s[len(" to %<"):end]), Type: TODIMENORSPREADDIMEN})
+				s = s[end+2:]
+				continue
+			}
+			s = s[1:]
+		case strings.HasPrefix(s, "%<"):
+			end := strings.Index(s, "%>")
+			if end < 0 {
+				return nil, "", fmt.Errorf("missing %%> in placeholder")
+			}
+			args = append(args, &Argument{Name: cwlPlaceholderName(s[2:end]), Type: MANDARG})
+			s = s[end+2:]
+		case s[0] == '#':
+			return args, s[1:], nil
+		case cwlClosing[s[0]] != 0:
+			end := matchingBracket(s)
+			if end < 0 {
+				return nil, "", fmt.Errorf("unbalanced %c", s[0])
+			}
+			inner := s[1:end]
+			arg := &Argument{Name: cwlPlaceholderName(inner)}
+			switch {
+			case strings.HasSuffix(inner, "%keyvals"):
+				arg.Type = KEYVALLIST
+				arg.Optional = s[0] != '{'
+			case s[0] == '{':
+				arg.Type = MANDARG
+			case s[0] == '<' || s[0] == '(':
+				// beamer overlays and picture coordinates
+				arg.Type = DELIMITED
+				arg.Delimiters = s[:1] + s[end:end+1]
+				arg.Optional = s[0] == '<'
+			default:
+				arg.Type = OPTARG
+				arg.Optional = true
+			}
+			args = append(args, arg)
+			s = s[end+1:]
+		default:
+			return nil, "", fmt.Errorf("unexpected %q", s)
+		}
+	}
+	return args, "", nil
+}
+
+// matchingBracket returns the index of the bracket that closes s[0], or -1.
+func matchingBracket(s string) int {
+	open, closing := s[0], cwlClosing[s[0]]
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case open:
+			depth++
+		case closing:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// cwlPlaceholderName removes the %< %> markers and the type suffix such as
+// %text or %keyvals from a placeholder.
+func cwlPlaceholderName(s string) string {
+	s = strings.TrimPrefix(s, "%<")
+	s = strings.TrimSuffix(s, "%>")
+	if i := strings.LastIndex(s, "%"); i > 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// splitCWLClassifier splits a classifier such as m\array,tabular into the
+// flags before the first backslash and the list of environments after it.
+func splitCWLClassifier(classifier string) (string, []string) {
+	i := strings.IndexByte(classifier, '\\')
+	if i < 0 {
+		return classifier, nil
+	}
+	return classifier[:i], strings.Split(classifier[i+1:], ",")
+}
+
+// cwlModes returns the modes of a command for the classifiers p (preamble
+// only) and m (math only).
+func cwlModes(classifier string) []Mode {
+	flags, _ := splitCWLClassifier(classifier)
+	switch {
+	case strings.Contains(flags, "p"):
+		return []Mode{PREAMBLEMODE}
+	case strings.Contains(flags, "m"):
+		return []Mode{MATHMODE}
+	}
+	return nil
+}
+
+// cwlParents returns the environments a command is restricted to by a
+// classifier such as \enumerate,itemize. \math is handled as the math label.
+func cwlParents(classifier string) []string {
+	_, envs := splitCWLClassifier(classifier)
+	var parents []string
+	for _, env := range envs {
+		if env != "" && env != "math" {
+			parents = append(parents, env)
+		}
+	}
+	return parents
+}
+
+// applyCWLClassifier sets the math label for the classifiers m and \math,
+// the expert level for * and the internal level for S (not shown in the
+// completion).
+func applyCWLClassifier(classifier string, labels []string, level Level, env bool) ([]string, Level) {
+	flags, envs := splitCWLClassifier(classifier)
+	if hasTag(envs, "math") || !env && strings.Contains(flags, "m") {
+		if !hasTag(labels, "math") {
+			labels = append(labels, "math")
+		}
+	}
+	if strings.Contains(flags, "S") && level < INTERNAL {
+		level = INTERNAL
+	} else if strings.Contains(flags, "*") && level < EXPERT {
+		level = EXPERT
+	}
+	return labels, level
+}
+
+// addCWLVariant adds a variant. Word lists often contain a line with and
+// a line without the optional arguments, so an existing variant with the same
+// name is replaced by the one with more arguments.
+func addCWLVariant(variants []Variant, name string, args []*Argument) []Variant {
+	for i, v := range variants {
+		if v.Name == name {
+			if len(args) > len(v.Arguments) {
+				variants[i].Arguments = args
+			}
+			return variants
+		}
+	}
+	v := NewVariant()
+	v.Name = name
+	v.Arguments = args
+	return append(variants, *v)
+}
+
+// importEntries adds the entries of imported to l without changing the
+// fields of existing entries.
+func (l *Ltxref) importEntries(imported *Ltxref) {
+	l.Commands = importCommands(l.Commands, imported.Commands)
+	for _, env := range imported.Environments {
+		i := environmentIndex(l.Environments, env.Name)
+		if i < 0 {
+			l.Environments = append(l.Environments, env)
+			continue
+		}
+		existing := l.Environments[i]
+		existing.Label = importLabels(existing.Label, env.Label)
+		existing.Variant = importVariants(existing.Variant, env.Variant)
+	}
+	for _, pkg := range imported.Packages {
+		i := packageIndex(l.Packages, pkg.Name)
+		if i < 0 {
+			l.Packages = append(l.Packages, pkg)
+			continue
+		}
+		existing := l.Packages[i]
+		existing.LoadsPackages = importLabels(existing.LoadsPackages, pkg.LoadsPackages)
+		for _, po := range pkg.Options {
+			found := false
+			for _, epo := range existing.Options {
+				if epo.Name == po.Name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				existing.Options = append(existing.Options, po)
+			}
+		}
+		existing.Commands = importCommands(existing.Commands, pkg.Commands)
+	}
+	sort.Sort(l.Commands)
+	sort.Sort(l.Environments)
+	sort.Sort(l.Packages)
+	l.Sources = append(l.Sources, imported.Sources...)
+}
+
+func importCommands(existing Commands, imported Commands) Commands {
+	for _, cmd := range imported {
+		i := commandIndex(existing, cmd.Name)
+		if i < 0 {
+			existing = append(existing, cmd)
+			continue
+		}
+		existing[i].Label = importLabels(existing[i].Label, cmd.Label)
+		existing[i].Variant = importVariants(existing[i].Variant, cmd.Variant)
+	}
+	sort.Sort(existing)
+	return existing
+}
+
+func importLabels(existing []string, imported []string) []string {
+	for _, label := range imported {
+		if !hasTag(existing, label) {
+			existing = append(existing, label)
+		}
+	}
+	return existing
+}
+
+// importVariants adds the imported variants whose names do not exist yet.
+func importVariants(existing []Variant, imported []Variant) []Variant {
+	for _, v := range imported {
+		found := false
+		for _, ev := range existing {
+			if ev.Name == v.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			existing = append(existing, v)
+		}
+	}
+	return existing
+}
@@ -0,0 +1,144 @@
+package ltxref
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCWLArguments(t *testing.T) {
+	tests := []struct {
+		s          string
+		args       []*Argument
+		classifier string
+	}{
+		{"[opt]{arg}#m", []*Argument{
+			{Name: "opt", Type: OPTARG, Optional: true},
+			{Name: "arg", Type: MANDARG},
+		}, "m"},
+		{"<overlay>{x}", []*Argument{
+			{Name: "overlay", Type: DELIMITED, Delimiters: "<>", Optional: true},
+			{Name: "x", Type: MANDARG},
+		}, ""},
+		{" %<text%>", []*Argument{{Name: "text", Type: MANDARG}}, ""},
+		{"{opts%keyvals}", []*Argument{{Name: "opts", Type: KEYVALLIST}}, ""},
+		{"[options%keyvals]", []*Argument{{Name: "options", Type: KEYVALLIST, Optional: true}}, ""},
+		{"(x,y)", []*Argument{{Name: "x,y", Type: DELIMITED, Delimiters: "()"}}, ""},
+		{"{a}#S", []*Argument{{Name: "a", Type: MANDARG}}, "S"},
+	}
+	for _, tt := range tests {
+		args, classifier, err := parseCWLArguments(tt.s)
+		if err != nil {
+			t.Errorf("parseCWLArguments(%q): %v", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tt.args) || classifier != tt.classifier {
+			t.Errorf("parseCWLArguments(%q) = %v %q, want %v %q", tt.s, args, classifier, tt.args, tt.classifier)
+		}
+	}
+	for _, s := range []string{"{a", "[a", " %<text"} {
+		if _, _, err := parseCWLArguments(s); err == nil {
+			t.Errorf("parseCWLArguments(%q): no error", s)
+		}
+	}
+}
+
+const testCWL = `# mypkg package
+#include:graphicx
+\cmd[opt]{arg}#m
+\cmd{arg}#m
+\ov<overlay>{x}
+\setup{opts%keyvals}
+\begin{env}{x}#\math
+\end{env}
+#keyvals:\usepackage/mypkg#c
+draft
+margin=##L
+paper=#a4paper,letterpaper
+#endkeyvals
+#keyvals:\setup
+width=##L
+#endkeyvals
+not a command
+\bad{unbalanced
+`
+
+func TestReadCWL(t *testing.T) {
+	l, problems, err := ReadCWL(strings.NewReader(testCWL), "mypkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 || problems[0].Line != 17 || problems[1].Line != 18 {
+		t.Errorf("got problems %v, want lines 17 and 18", problems)
+	}
+	pkg := l.GetPackageWithName("mypkg")
+	if pkg == nil {
+		t.Fatal("package mypkg missing")
+	}
+	if !reflect.DeepEqual(pkg.LoadsPackages, []string{"graphicx"}) {
+		t.Errorf("got loaded packages %v", pkg.LoadsPackages)
+	}
+	cmd := l.GetCommandFromPackage(`\cmd`, "mypkg")
+	if cmd == nil {
+		t.Fatal(`\cmd missing`)
+	}
+	if len(cmd.Variant) != 1 || len(cmd.Variant[0].Arguments) != 2 {
+		t.Errorf(`\cmd: got variants %v`, cmd.Variant)
+	}
+	if !hasTag(cmd.Label, "math") || !reflect.DeepEqual(cmd.Modes, []Mode{MATHMODE}) {
+		t.Errorf(`\cmd: got labels %v and modes %v`, cmd.Label, cmd.Modes)
+	}
+	if l.GetCommandFromPackage(`\ov`, "mypkg") == nil || l.GetCommandFromPackage(`\setup`, "mypkg") == nil {
+		t.Error(`\ov or \setup missing`)
+	}
+	env := l.GetEnvironmentWithName("env")
+	if env == nil || !hasTag(env.Label, "math") || len(env.Variant) != 1 || len(env.Variant[0].Arguments) != 1 {
+		t.Errorf("env: got %v", env)
+	}
+	var options []string
+	for _, po := range pkg.Options {
+		options = append(options, po.Name)
+	}
+	if !reflect.DeepEqual(options, []string{"draft", "margin", "paper"}) {
+		t.Fatalf("got options %v", options)
+	}
+	if po := pkg.Options[1]; po.Kind != KEYVALOPTION || po.Type != DIMENSIONVALUE {
+		t.Errorf("margin: got %v %v", po.Kind, po.Type)
+	}
+	if po := pkg.Options[2]; po.Kind != CHOICEOPTION || !reflect.DeepEqual(po.Values, []string{"a4paper", "letterpaper"}) {
+		t.Errorf("paper: got %v %v", po.Kind, po.Values)
+	}
+}
+
+func TestImportCWL(t *testing.T) {
+	l := &Ltxref{}
+	if _, err := l.AddPackage("mypkg"); err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := l.AddCommand(`\cmd`, "mypkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.ShortDescription["en"] = "A command"
+	cmd.Level = EXPERT
+	cmd.Label = []string{"font"}
+	if _, err = l.ImportCWL(strings.NewReader(testCWL), "mypkg"); err != nil {
+		t.Fatal(err)
+	}
+	cmd = l.GetCommandFromPackage(`\cmd`, "mypkg")
+	if cmd.ShortDescription["en"] != "A command" || cmd.Level != EXPERT {
+		t.Errorf(`\cmd: got %q %v`, cmd.ShortDescription["en"], cmd.Level)
+	}
+	if !hasTag(cmd.Label, "font") || !hasTag(cmd.Label, "math") {
+		t.Errorf(`\cmd: got labels %v`, cmd.Label)
+	}
+	if len(cmd.Variant) != 1 {
+		t.Errorf(`\cmd: got %d variants`, len(cmd.Variant))
+	}
+	if l.GetCommandFromPackage(`\ov`, "mypkg") == nil || l.GetEnvironmentWithName("env") == nil {
+		t.Error("new entries missing")
+	}
+	if pkg := l.GetPackageWithName("mypkg"); len(pkg.Options) != 3 || !hasTag(pkg.LoadsPackages, "graphicx") {
+		t.Errorf("mypkg: got options %v, loaded packages %v", pkg.Options, pkg.LoadsPackages)
+	}
+}
@@ -0,0 +1,616 @@
+package ltxref
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ChangeType tells if an entry has been added, removed or changed.
+type ChangeType int
+
+const (
+	_ ChangeType = iota
+	ADDED
+	REMOVED
+	CHANGED
+)
+
+func (ct ChangeType) String() string {
+	switch ct {
+	case ADDED:
+		return "added"
+	case REMOVED:
+		return "removed"
+	case CHANGED:
+		return "changed"
+	}
+	return fmt.Sprintf("changetype(%d)", int(ct))
+}
+
+func (ct ChangeType) MarshalText() ([]byte, error) {
+	return []byte(ct.String()), nil
+}
+
+// EntryKind is the kind of an entry in the reference.
+type EntryKind int
+
+const (
+	_ EntryKind = iota
+	COMMAND
+	ENVIRONMENT
+	DOCUMENTCLASS
+	PACKAGE
+)
+
+func (ek EntryKind) String() string {
+	switch ek {
+	case COMMAND:
+		return "command"
+	case ENVIRONMENT:
+		return "environment"
+	case DOCUMENTCLASS:
+		return "documentclass"
+	case PACKAGE:
+		return "package"
+	}
+	return fmt.Sprintf("entrykind(%d)", int(ek))
+}
+
+func (ek EntryKind) MarshalText() ([]byte, error) {
+	return []byte(ek.String()), nil
+}
+
+// A FieldChange is a difference in one field of a changed entry. Old is empty
+// if the field has been added, New is empty if it has been removed.
+type FieldChange struct {
+	// Field is the path to the field, such as "level", "description (en)"
+	// or "variant \section* / argument 1 / type".
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// A Change describes one entry that differs between two versions of the
+// reference.
+type Change struct {
+	Type ChangeType `json:"type"`
+	Kind EntryKind  `json:"kind"`
+	// Package is the name of the package for package commands, empty
+	// otherwise.
+	Package string `json:"package,omitempty"`
+	Name    string `json:"name"`
+	// Fields lists the differences of a CHANGED entry.
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+func (c Change) String() string {
+	if c.Package != "" {
+		return fmt.Sprintf("%s %s %s (package %s)", c.Type, c.Kind, c.Name, c.Package)
+	}
+	return fmt.Sprintf("%s %s %s", c.Type, c.Kind, c.Name)
+}
+
+// Changeset is the list of changes between two versions of the reference.
+type Changeset struct {
+	OldVersion string   `json:"oldversion"`
+	NewVersion string   `json:"newversion"`
+	Changes    []Change `json:"changes"`
+}
+
+// Diff returns the changes needed to get from a to b. Entries are matched by
+// kind and name, package commands also by the package name. Either argument
+// may be nil, which is the same as an empty reference.
+func Diff(a, b *Ltxref) Changeset {
+	if a == nil {
+		a = &Ltxref{}
+	}
+	if b == nil {
+		b = &Ltxref{}
+	}
+	cs := Changeset{OldVersion: a.Version, NewVersion: b.Version}
+	cs.Changes = append(cs.Changes, diffCommands("", a.Commands, b.Commands)...)
+
+	oldenvs := make(map[string]*Environment, len(a.Environments))
+	for _, env := range a.Environments {
+		oldenvs[env.Name] = env
+	}
+	for _, env := range b.Environments {
+		if old, ok := oldenvs[env.Name]; !ok {
+			cs.add(ADDED, ENVIRONMENT, "", env.Name, nil)
+		} else {
+			cs.add(CHANGED, ENVIRONMENT, "", env.Name, diffEnvironment(old, env))
+		}
+		delete(oldenvs, env.Name)
+	}
+	for _, env := range a.Environments {
+		if _, ok := oldenvs[env.Name]; ok {
+			cs.add(REMOVED, ENVIRONMENT, "", env.Name, nil)
+		}
+	}
+
+	oldclasses := make(map[string]*DocumentClass, len(a.DocumentClasses))
+	for _, dc := range a.DocumentClasses {
+		oldclasses[dc.Name] = dc
+	}
+	for _, dc := range b.DocumentClasses {
+		if old, ok := oldclasses[dc.Name]; !ok {
+			cs.add(ADDED, DOCUMENTCLASS, "", dc.Name, nil)
+		} else {
+			cs.add(CHANGED, DOCUMENTCLASS, "", dc.Name, diffDocumentClass(old, dc))
+		}
+		delete(oldclasses, dc.Name)
+	}
+	for _, dc := range a.DocumentClasses {
+		if _, ok := oldclasses[dc.Name]; ok {
+			cs.add(REMOVED, DOCUMENTCLASS, "", dc.Name, nil)
+		}
+	}
+
+	oldpkgs := make(map[string]*Package, len(a.Packages))
+	for _, pkg := range a.Packages {
+		oldpkgs[pkg.Name] = pkg
+	}
+	for _, pkg := range b.Packages {
+		old, ok := oldpkgs[pkg.Name]
+		if !ok {
+			cs.add(ADDED, PACKAGE, "", pkg.Name, nil)
+			cs.Changes = append(cs.Changes, diffCommands(pkg.Name, nil, pkg.Commands)...)
+			continue
+		}
+		delete(oldpkgs, pkg.Name)
+		cs.add(CHANGED, PACKAGE, "", pkg.Name, diffPackage(old, pkg))
+		cs.Changes = append(cs.Changes, diffCommands(pkg.Name, old.Commands, pkg.Commands)...)
+	}
+	for _, pkg := range a.Packages {
+		if _, ok := oldpkgs[pkg.Name]; ok {
+			cs.add(REMOVED, PACKAGE, "", pkg.Name, nil)
+			cs.Changes = append(cs.Changes, diffCommands(pkg.Name, pkg.Commands, nil)...)
+		}
+	}
+	return cs
+}
+
+// add appends a change to the changeset. CHANGED entries without field
+// changes are ignored.
+func (cs *Changeset) add(ct ChangeType, kind EntryKind, pkgname string, name string, fields []FieldChange) {
+	if ct == CHANGED && len(fields) == 0 {
+		return
+	}
+	cs.Changes = append(cs.Changes, Change{Type: ct, Kind: kind, Package: pkgname, Name: name, Fields: fields})
+}
+
+func diffCommands(pkgname string, a, b Commands) []Change {
+	var cs Changeset
+	oldcmds := make(map[string]*Command, len(a))
+	for _, cmd := range a {
+		oldcmds[cmd.Name] = cmd
+	}
+	for _, cmd := range b {
+		if old, ok := oldcmds[cmd.Name]; !ok {
+			cs.add(ADDED, COMMAND, pkgname, cmd.Name, nil)
+		} else {
+			cs.add(CHANGED, COMMAND, pkgname, cmd.Name, diffCommand(old, cmd))
+		}
+		delete(oldcmds, cmd.Name)
+	}
+	for _, cmd := range a {
+		if _, ok := oldcmds[cmd.Name]; ok {
+			cs.add(REMOVED, COMMAND, pkgname, cmd.Name, nil)
+		}
+	}
+	return cs.Changes
+}
+
+func diffCommand(a, b *Command) []FieldChange {
+	var fc []FieldChange
+	fc = diffString(fc, "level", a.Level.String(), b.Level.String())
+	fc = diffString(fc, "label", strings.Join(a.Label, ","), strings.Join(b.Label, ","))
+	fc = diffShortDescription(fc, "", a.ShortDescription, b.ShortDescription)
+	fc = diffDescription(fc, "", a.Description, b.Description)
+	fc = diffExamples(fc, "", a.Examples, b.Examples)
+	fc = diffVariants(fc, a.Variant, b.Variant)
+	fc = diffString(fc, "modes", formatModes(a.Modes), formatModes(b.Modes))
+	fc = diffString(fc, "parents", strings.Join(a.Parents, ","), strings.Join(b.Parents, ","))
+	fc = diffString(fc, "seealso", strings.Join(a.SeeAlso, ","), strings.Join(b.SeeAlso, ","))
+	fc = diffHistory(fc, "", a.History, b.History)
+	return fc
+}
+
+func diffEnvironment(a, b *Environment) []FieldChange {
+	var fc []FieldChange
+	fc = diffString(fc, "level", a.Level.String(), b.Level.String())
+	fc = diffString(fc, "label", strings.Join(a.Label, ","), strings.Join(b.Label, ","))
+	fc = diffShortDescription(fc, "", a.ShortDescription, b.ShortDescription)
+	fc = diffDescription(fc, "", a.Description, b.Description)
+	fc = diffExamples(fc, "", a.Examples, b.Examples)
+	fc = diffVariants(fc, a.Variant, b.Variant)
+	fc = diffString(fc, "modes", formatModes(a.Modes), formatModes(b.Modes))
+	fc = diffString(fc, "parents", strings.Join(a.Parents, ","), strings.Join(b.Parents, ","))
+	fc = diffString(fc, "seealso", strings.Join(a.SeeAlso, ","), strings.Join(b.SeeAlso, ","))
+	fc = diffHistory(fc, "", a.History, b.History)
+	return fc
+}
+
+func diffDocumentClass(a, b *DocumentClass) []FieldChange {
+	var fc []FieldChange
+	fc = diffString(fc, "level", a.Level.String(), b.Level.String())
+	fc = diffString(fc, "label", strings.Join(a.Label, ","), strings.Join(b.Label, ","))
+	fc = diffShortDescription(fc, "", a.ShortDescription, b.ShortDescription)
+	fc = diffDescription(fc, "", a.Description, b.Description)
+	fc = diffOptiongroups(fc, a.Optiongroup, b.Optiongroup)
+	oldopts := make(map[string]*Classoption)
+	for _, og := range a.Optiongroup {
+		for _, co := range og.Classoption {
+			oldopts[co.Name] = co
+		}
+	}
+	for _, og := range b.Optiongroup {
+		for _, co := range og.Classoption {
+			prefix := "option " + co.Name
+			old, ok := oldopts[co.Name]
+			if !ok {
+				fc = append(fc, FieldChange{Field: prefix, New: co.Name})
+				continue
+			}
+			delete(oldopts, co.Name)
+			fc = diffString(fc, prefix+" / default", yesno(old.Default), yesno(co.Default))
+			fc = diffOptionValue(fc, prefix, old.OptionValue, co.OptionValue)
+			fc = diffShortDescription(fc, prefix+" / ", old.ShortDescription, co.ShortDescription)
+			fc = diffHistory(fc, prefix+" / ", old.History, co.History)
+		}
+	}
+	for _, og := range a.Optiongroup {
+		for _, co := range og.Classoption {
+			if _, ok := oldopts[co.Name]; ok {
+				fc = append(fc, FieldChange{Field: "option " + co.Name, Old: co.Name})
+			}
+		}
+	}
+	return fc
+}
+
+// diffOptiongroups matches the groups by their options: a new group belongs
+// to the old group with the most options in common. Matched groups are
+// compared by short description, exclusiveness and their list of options.
+// The options themselves are compared in diffDocumentClass.
+func diffOptiongroups(fc []FieldChange, a, b []*Optiongroup) []FieldChange {
+	matched := make([]bool, len(a))
+	for i, og := range b {
+		names := optiongroupNames(og)
+		best, bestcount := -1, 0
+		for j, old := range a {
+			if matched[j] {
+				continue
+			}
+			oldnames := optiongroupNames(old)
+			count := 0
+			for _, name := range oldnames {
+				if hasTag(names, name) {
+					count++
+				}
+			}
+			if count > bestcount || best < 0 && len(names) == 0 && len(oldnames) == 0 {
+				best, bestcount = j, count
+			}
+		}
+		prefix := optiongroupField(i, names)
+		if best < 0 {
+			fc = append(fc, FieldChange{Field: prefix, New: strings.Join(names, ",")})
+			continue
+		}
+		matched[best] = true
+		old := a[best]
+		fc = diffString(fc, prefix+" / options", strings.Join(optiongroupNames(old), ","), strings.Join(names, ","))
+		fc = diffString(fc, prefix+" / exclusive", yesno(old.Exclusive), yesno(og.Exclusive))
+		fc = diffShortDescription(fc, prefix+" / ", old.ShortDescription, og.ShortDescription)
+	}
+	for j, og := range a {
+		if !matched[j] {
+			names := optiongroupNames(og)
+			fc = append(fc, FieldChange{Field: optiongroupField(j, names), Old: strings.Join(names, ",")})
+		}
+	}
+	return fc
+}
+
+func optiongroupNames(og *Optiongroup) []string {
+	var names []string
+	for _, co := range og.Classoption {
+		names = append(names, co.Name)
+	}
+	return names
+}
+
+// optiongroupField names a group by its options or by its position i if it
+// has none.
+func optiongroupField(i int, names []string) string {
+	if len(names) == 0 {
+		return fmt.Sprintf("optiongroup %d", i+1)
+	}
+	return "optiongroup " + strings.Join(names, ",")
+}
+
+func diffOptionValue(fc []FieldChange, prefix string, a, b OptionValue) []FieldChange {
+	fc = diffString(fc, prefix+" / kind", a.Kind.String(), b.Kind.String())
+	fc = diffString(fc, prefix+" / valuetype", a.Type.String(), b.Type.String())
+	fc = diffString(fc, prefix+" / values", strings.Join(a.Values, ","), strings.Join(b.Values, ","))
+	fc = diffString(fc, prefix+" / defaultvalue", a.DefaultValue, b.DefaultValue)
+	return fc
+}
+
+func diffPackage(a, b *Package) []FieldChange {
+	var fc []FieldChange
+	fc = diffString(fc, "level", a.Level.String(), b.Level.String())
+	fc = diffString(fc, "label", strings.Join(a.Label, ","), strings.Join(b.Label, ","))
+	fc = diffString(fc, "loadspackages", strings.Join(a.LoadsPackages, ","), strings.Join(b.LoadsPackages, ","))
+	fc = diffShortDescription(fc, "", a.ShortDescription, b.ShortDescription)
+	fc = diffDescription(fc, "", a.Description, b.Description)
+	fc = diffExamples(fc, "", a.Examples, b.Examples)
+	fc = diffHistory(fc, "", a.History, b.History)
+	oldopts := make(map[string]*Packageoption)
+	for _, po := range a.Options {
+		oldopts[po.Name] = po
+	}
+	for _, po := range b.Options {
+		prefix := "option " + po.Name
+		old, ok := oldopts[po.Name]
+		if !ok {
+			fc = append(fc, FieldChange{Field: prefix, New: po.Name})
+			continue
+		}
+		delete(oldopts, po.Name)
+		fc = diffString(fc, prefix+" / default", yesno(old.Default), yesno(po.Default))
+		fc = diffOptionValue(fc, prefix, old.OptionValue, po.OptionValue)
+		fc = diffShortDescription(fc, prefix+" / ", old.ShortDescription, po.ShortDescription)
+		fc = diffHistory(fc, prefix+" / ", old.History, po.History)
+	}
+	for _, po := range a.Options {
+		if _, ok := oldopts[po.Name]; ok {
+			fc = append(fc, FieldChange{Field: "option " + po.Name, Old: po.Name})
+		}
+	}
+	return fc
+}
+
+func diffVariants(fc []FieldChange, a, b []Variant) []FieldChange {
+	oldvariants := make(map[string]Variant, len(a))
+	for _, v := range a {
+		oldvariants[v.Name] = v
+	}
+	for _, v := range b {
+		prefix := "variant " + v.Name
+		old, ok := oldvariants[v.Name]
+		if !ok {
+			fc = append(fc, FieldChange{Field: prefix, New: v.Signature()})
+			continue
+		}
+		delete(oldvariants, v.Name)
+		for i := 0; i < len(old.Arguments) || i < len(v.Arguments); i++ {
+			argprefix := fmt.Sprintf("%s / argument %d", prefix, i+1)
+			switch {
+			case i >= len(old.Arguments):
+				fc = append(fc, FieldChange{Field: argprefix, New: v.Arguments[i].Signature()})
+			case i >= len(v.Arguments):
+				fc = append(fc, FieldChange{Field: argprefix, Old: old.Arguments[i].Signature()})
+			default:
+				olda, newa := old.Arguments[i], v.Arguments[i]
+				fc = diffString(fc, argprefix+" / name", olda.Name, newa.Name)
+				fc = diffString(fc, argprefix+" / type", argumentTypeReveseMap[olda.Type], argumentTypeReveseMap[newa.Type])
+				fc = diffString(fc, argprefix+" / optional", yesno(olda.Optional), yesno(newa.Optional))
+				fc = diffString(fc, argprefix+" / delimiters", olda.Delimiters, newa.Delimiters)
+				fc = diffString(fc, argprefix+" / default", olda.Default, newa.Default)
+				fc = diffString(fc, argprefix+" / hasdefault", yesno(olda.hasDefault()), yesno(newa.hasDefault()))
+				fc = diffString(fc, argprefix+" / long", yesno(olda.Long), yesno(newa.Long))
+				fc = diffDescription(fc, argprefix+" / ", olda.Description, newa.Description)
+				fc = diffKeys(fc, argprefix, olda.Keys, newa.Keys)
+			}
+		}
+		fc = diffDescription(fc, prefix+" / ", old.Description, v.Description)
+		fc = diffExamples(fc, prefix+" / ", old.Examples, v.Examples)
+		fc = diffHistory(fc, prefix+" / ", old.History, v.History)
+	}
+	for _, v := range a {
+		if _, ok := oldvariants[v.Name]; ok {
+			fc = append(fc, FieldChange{Field: "variant " + v.Name, Old: v.Signature()})
+		}
+	}
+	return fc
+}
+
+func diffString(fc []FieldChange, field string, a, b string) []FieldChange {
+	if a != b {
+		fc = append(fc, FieldChange{Field: field, Old: a, New: b})
+	}
+	return fc
+}
+
+// diffExamples compares the examples by position.
+func diffExamples(fc []FieldChange, prefix string, a, b []*Example) []FieldChange {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		exprefix := fmt.Sprintf("%sexample %d", prefix, i+1)
+		switch {
+		case i >= len(a):
+			fc = append(fc, FieldChange{Field: exprefix, New: b[i].Source})
+		case i >= len(b):
+			fc = append(fc, FieldChange{Field: exprefix, Old: a[i].Source})
+		default:
+			fc = diffString(fc, exprefix+" / title", a[i].Title, b[i].Title)
+			fc = diffString(fc, exprefix+" / lang", a[i].Lang, b[i].Lang)
+			fc = diffString(fc, exprefix+" / source", a[i].Source, b[i].Source)
+			fc = diffString(fc, exprefix+" / output", a[i].Output, b[i].Output)
+		}
+	}
+	return fc
+}
+
+// diffHistory compares the version information.
+func diffHistory(fc []FieldChange, prefix string, a, b History) []FieldChange {
+	fc = diffString(fc, prefix+"since", a.Since, b.Since)
+	fc = diffString(fc, prefix+"deprecated", a.Deprecated, b.Deprecated)
+	fc = diffString(fc, prefix+"replacedby", a.ReplacedBy, b.ReplacedBy)
+	fc = diffString(fc, prefix+"removed", a.Removed, b.Removed)
+	return fc
+}
+
+// diffShortDescription compares the descriptions for each language.
+func diffShortDescription(fc []FieldChange, prefix string, a, b map[string]string) []FieldChange {
+	for _, lang := range languages(a, b) {
+		fc = diffString(fc, fmt.Sprintf("%sshortdescription (%s)", prefix, lang), a[lang], b[lang])
+	}
+	return fc
+}
+
+// diffKeys compares the keys of a key value argument by name.
+func diffKeys(fc []FieldChange, prefix string, a, b []*Key) []FieldChange {
+	oldkeys := make(map[string]*Key, len(a))
+	for _, k := range a {
+		oldkeys[k.Name] = k
+	}
+	for _, k := range b {
+		keyprefix := prefix + " / key " + k.Name
+		old, ok := oldkeys[k.Name]
+		if !ok {
+			fc = append(fc, FieldChange{Field: keyprefix, New: k.Type.String()})
+			continue
+		}
+		delete(oldkeys, k.Name)
+		fc = diffString(fc, keyprefix+" / type", old.Type.String(), k.Type.String())
+		fc = diffString(fc, keyprefix+" / choices", strings.Join(old.Choices, ","), strings.Join(k.Choices, ","))
+		fc = diffString(fc, keyprefix+" / default", old.Default, k.Default)
+		fc = diffString(fc, keyprefix+" / level", old.Level.String(), k.Level.String())
+		fc = diffDescription(fc, keyprefix+" / ", old.Description, k.Description)
+	}
+	for _, k := range a {
+		if _, ok := oldkeys[k.Name]; ok {
+			fc = append(fc, FieldChange{Field: prefix + " / key " + k.Name, Old: k.Type.String()})
+		}
+	}
+	return fc
+}
+
+// diffDescription compares the descriptions for each language.
+func diffDescription(fc []FieldChange, prefix string, a, b map[string]template.HTML) []FieldChange {
+	la := make(map[string]string, len(a))
+	for lang, text := range a {
+		la[lang] = string(text)
+	}
+	lb := make(map[string]string, len(b))
+	for lang, text := range b {
+		lb[lang] = string(text)
+	}
+	for _, lang := range languages(la, lb) {
+		fc = diffString(fc, fmt.Sprintf("%sdescription (%s)", prefix, lang), la[lang], lb[lang])
+	}
+	return fc
+}
+
+// languages returns the sorted keys of both maps.
+func languages(a, b map[string]string) []string {
+	seen := make(map[string]bool)
+	var langs []string
+	for _, m := range []map[string]string{a, b} {
+		for lang := range m {
+			if !seen[lang] {
+				seen[lang] = true
+				langs = append(langs, lang)
+			}
+		}
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+func yesno(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func (cs Changeset) title() string {
+	switch {
+	case cs.OldVersion == cs.NewVersion:
+		return "Changes"
+	case cs.OldVersion == "":
+		return "Changes in version " + cs.NewVersion
+	}
+	return fmt.Sprintf("Changes from version %s to %s", cs.OldVersion, cs.NewVersion)
+}
+
+// ToText writes the changeset as plain text.
+func (cs Changeset) ToText(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString(tfunderline(cs.title(), 1))
+	for _, c := range cs.Changes {
+		fmt.Fprintln(&b, c)
+		for _, f := range c.Fields {
+			fmt.Fprintf(&b, "    %s: %q -> %q\n", f.Field, f.Old, f.New)
+		}
+	}
+	_, err := b.WriteTo(w)
+	return err
+}
+
+var changeTypeHeadings = map[ChangeType]string{
+	ADDED:   "Added",
+	REMOVED: "Removed",
+	CHANGED: "Changed",
+}
+
+var entryKindHeadings = map[EntryKind]string{
+	COMMAND:       "commands",
+	ENVIRONMENT:   "environments",
+	DOCUMENTCLASS: "document classes",
+	PACKAGE:       "packages",
+}
+
+// ToMarkdown writes the changeset as Markdown, grouped by change type and
+// kind of entry, suitable for release notes.
+func (cs Changeset) ToMarkdown(w io.Writer) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n", cs.title())
+	for _, ct := range []ChangeType{ADDED, REMOVED, CHANGED} {
+		for _, kind := range []EntryKind{COMMAND, ENVIRONMENT, DOCUMENTCLASS, PACKAGE} {
+			heading := false
+			for _, c := range cs.Changes {
+				if c.Type != ct || c.Kind != kind {
+					continue
+				}
+				if !heading {
+					fmt.Fprintf(&b, "\n## %s %s\n\n", changeTypeHeadings[ct], entryKindHeadings[kind])
+					heading = true
+				}
+				if c.Package != "" {
+					fmt.Fprintf(&b, "- `%s` (package `%s`)\n", c.Name, c.Package)
+				} else {
+					fmt.Fprintf(&b, "- `%s`\n", c.Name)
+				}
+				for _, f := range c.Fields {
+					switch {
+					case strings.Contains(f.Old+f.New, "\n"):
+						// Long texts such as descriptions don't fit in a list
+						fmt.Fprintf(&b, "    - %s changed\n", f.Field)
+					case f.Old == "":
+						fmt.Fprintf(&b, "    - %s: added `%s`\n", f.Field, f.New)
+					case f.New == "":
+						fmt.Fprintf(&b, "    - %s: removed `%s`\n", f.Field, f.Old)
+					default:
+						fmt.Fprintf(&b, "    - %s: `%s` → `%s`\n", f.Field, f.Old, f.New)
+					}
+				}
+			}
+		}
+	}
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// ToJSON returns the changeset encoded as JSON.
+func (cs Changeset) ToJSON() ([]byte, error) {
+	return json.MarshalIndent(cs, "", "  ")
+}
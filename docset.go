@@ -0,0 +1,112 @@
+package ltxref
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dashTypes maps the kinds of the site entries to the Dash entry types.
+var dashTypes = map[string]string{
+	"command":       "Command",
+	"environment":   "Environment",
+	"package":       "Package",
+	"documentclass": "Class",
+	"tag":           "Category",
+}
+
+// WriteDocset writes the reference as a Dash/Zeal docset name.docset into
+// dir. The docset contains the HTML pages of WriteHTML (with table of
+// contents anchors for the variants), the Info.plist and the search index
+// docSet.dsidx. Package commands are indexed as "\cmd (package)".
+//
+// The search index is an SQLite database. To keep this package free of cgo,
+// it is written through database/sql with the driver sqldriver, which the
+// caller has to register, for example by importing
+// github.com/mattn/go-sqlite3 and passing "sqlite3".
+func (l *Ltxref) WriteDocset(dir string, name string, lang string, sqldriver string) error {
+	contents := filepath.Join(dir, name+".docset", "Contents")
+	resources := filepath.Join(contents, "Resources")
+	hs := newHTMLSite(l, filepath.Join(resources, "Documents"), lang)
+	hs.dash = true
+	if err := hs.write(); err != nil {
+		return err
+	}
+	if err := writeInfoPlist(filepath.Join(contents, "Info.plist"), name); err != nil {
+		return err
+	}
+
+	dbfile := filepath.Join(resources, "docSet.dsidx")
+	// start with a fresh index
+	if err := os.Remove(dbfile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	db, err := sql.Open(sqldriver, dbfile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE searchIndex(id INTEGER PRIMARY KEY, name TEXT, type TEXT, path TEXT)",
+		"CREATE UNIQUE INDEX anchor ON searchIndex (name, type, path)",
+	} {
+		if _, err = tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	insert := func(name, typ, path string) error {
+		_, err := tx.Exec("INSERT OR IGNORE INTO searchIndex(name, type, path) VALUES (?, ?, ?)", name, typ, path)
+		return err
+	}
+	for _, e := range hs.allEntries() {
+		entryname := e.Name
+		if e.Package != "" {
+			entryname = fmt.Sprintf("%s (%s)", e.Name, e.Package)
+		}
+		if err = insert(entryname, dashTypes[e.Kind], e.URL+".html"); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, tag := range siteTags(l.Tags()) {
+		if err = insert(tag, dashTypes["tag"], tagPage(tag)+".html"); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func writeInfoPlist(filename string, name string) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	buf.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	entries := [][2]string{
+		{"CFBundleIdentifier", name},
+		{"CFBundleName", name},
+		{"DocSetPlatformFamily", strings.ToLower(name)},
+		{"dashIndexFilePath", "index.html"},
+		{"DashDocSetFamily", "dashtoc"},
+	}
+	for _, e := range entries {
+		buf.WriteString("<key>")
+		xml.EscapeText(&buf, []byte(e[0]))
+		buf.WriteString("</key>\n<string>")
+		xml.EscapeText(&buf, []byte(e[1]))
+		buf.WriteString("</string>\n")
+	}
+	buf.WriteString("<key>isDashDocset</key>\n<true/>\n")
+	buf.WriteString("<key>isJavaScriptEnabled</key>\n<true/>\n")
+	buf.WriteString("</dict>\n</plist>\n")
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
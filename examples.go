@@ -0,0 +1,117 @@
+package ltxref
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An ExampleFile is an example together with the entry it belongs to.
+type ExampleFile struct {
+	// File name such as "cmd-graphicx-includegraphics-1.tex"
+	Name string
+	// The package that must be loaded for the example, empty for kernel
+	// commands and environments
+	Package string
+	// The kind and the name of the command, environment or package
+	Kind    EntryKind
+	Entry   string
+	Example *Example
+}
+
+// Examples returns all examples in the reference. The examples of the
+// variants are counted with the examples of their command or environment.
+func (l *Ltxref) Examples() []ExampleFile {
+	var ret []ExampleFile
+	add := func(kind EntryKind, pkgname string, name string, variants []Variant, examples []*Example) {
+		var prefix string
+		switch kind {
+		case COMMAND:
+			prefix = "cmd-"
+			if pkgname != "" {
+				prefix += slug(pkgname) + "-"
+			}
+		case ENVIRONMENT:
+			prefix = "env-"
+		case PACKAGE:
+			prefix = "pkg-"
+		}
+		all := append([]*Example{}, examples...)
+		for _, v := range variants {
+			all = append(all, v.Examples...)
+		}
+		for i, ex := range all {
+			ret = append(ret, ExampleFile{
+				Name:    fmt.Sprintf("%s%s-%d.tex", prefix, slug(name), i+1),
+				Package: pkgname,
+				Kind:    kind,
+				Entry:   name,
+				Example: ex,
+			})
+		}
+	}
+	for _, cmd := range l.Commands {
+		add(COMMAND, "", cmd.Name, cmd.Variant, cmd.Examples)
+	}
+	for _, env := range l.Environments {
+		add(ENVIRONMENT, "", env.Name, env.Variant, env.Examples)
+	}
+	for _, pkg := range l.Packages {
+		add(PACKAGE, pkg.Name, pkg.Name, nil, pkg.Examples)
+		for _, cmd := range pkg.Commands {
+			add(COMMAND, pkg.Name, cmd.Name, cmd.Variant, cmd.Examples)
+		}
+	}
+	return ret
+}
+
+// examplesForLang returns the examples in the language lang and those
+// without a language.
+func examplesForLang(examples []*Example, lang string) []*Example {
+	var ret []*Example
+	for _, ex := range examples {
+		if ex.Lang == "" || ex.Lang == lang {
+			ret = append(ret, ex)
+		}
+	}
+	return ret
+}
+
+// Document returns the example as a standalone LaTeX document. A source
+// with \documentclass is returned unchanged. Otherwise a \documentclass line
+// for class (article if empty) and a \usepackage line for the package are
+// added, and the source is put into the document environment unless it
+// already contains \begin{document}.
+func (ef ExampleFile) Document(class string) string {
+	src := strings.Trim(ef.Example.Source, "\n")
+	if strings.Contains(src, `\documentclass`) {
+		return src + "\n"
+	}
+	if class == "" {
+		class = "article"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\\documentclass{%s}\n", class)
+	if ef.Package != "" {
+		fmt.Fprintf(&sb, "\\usepackage{%s}\n", ef.Package)
+	}
+	if strings.Contains(src, `\begin{document}`) {
+		sb.WriteString(src + "\n")
+		return sb.String()
+	}
+	sb.WriteString("\\begin{document}\n")
+	sb.WriteString(src + "\n")
+	sb.WriteString("\\end{document}\n")
+	return sb.String()
+}
+
+// WriteExampleFiles writes every example as a standalone document of the
+// given class into dir (see ExampleFile.Document) and returns the examples.
+func (l *Ltxref) WriteExampleFiles(dir string, class string) ([]ExampleFile, error) {
+	examples := l.Examples()
+	for _, ef := range examples {
+		if err := writePage(dir, ef.Name, []byte(ef.Document(class))); err != nil {
+			return nil, err
+		}
+	}
+	return examples, nil
+}
@@ -0,0 +1,23 @@
+package ltxref
+
+import "testing"
+
+func TestExampleFileDocument(t *testing.T) {
+	tests := []struct {
+		source string
+		pkg    string
+		class  string
+		want   string
+	}{
+		{`\section{A}`, "", "", "\\documentclass{article}\n\\begin{document}\n\\section{A}\n\\end{document}\n"},
+		{"\n\\includegraphics{a}\n", "graphicx", "book", "\\documentclass{book}\n\\usepackage{graphicx}\n\\begin{document}\n\\includegraphics{a}\n\\end{document}\n"},
+		{"\\begin{document}\nx\n\\end{document}", "", "", "\\documentclass{article}\n\\begin{document}\nx\n\\end{document}\n"},
+		{"\\documentclass{report}\n\\begin{document}\nx\n\\end{document}", "graphicx", "book", "\\documentclass{report}\n\\begin{document}\nx\n\\end{document}\n"},
+	}
+	for _, tt := range tests {
+		ef := ExampleFile{Package: tt.pkg, Example: &Example{Source: tt.source}}
+		if got := ef.Document(tt.class); got != tt.want {
+			t.Errorf("Document(%q) of %q = %q, want %q", tt.class, tt.source, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package ltxref
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An ExtractProblem is a definition in a package source that could not be
+// classified.
+type ExtractProblem struct {
+	Line       int
+	Definition string
+	Reason     string
+}
+
+func (p ExtractProblem) String() string {
+	return fmt.Sprintf("line %d: %s: %s", p.Line, p.Definition, p.Reason)
+}
+
+// ExtractReport lists what ExtractPackage could not put into the model.
+type ExtractReport struct {
+	// Keys defined with \pgfkeys or \pgfqkeys. They are no package options.
+	Keys         []string
+	Unclassified []ExtractProblem
+}
+
+// definers are the commands that ExtractPackage understands.
+var definers = map[string]bool{
+	`\newcommand`:                 true,
+	`\renewcommand`:               true,
+	`\providecommand`:             true,
+	`\DeclareRobustCommand`:       true,
+	`\newenvironment`:             true,
+	`\renewenvironment`:           true,
+	`\DeclareOption`:              true,
+	`\DeclareKeys`:                true,
+	`\pgfkeys`:                    true,
+	`\pgfqkeys`:                   true,
+	`\NewDocumentCommand`:         true,
+	`\RenewDocumentCommand`:       true,
+	`\ProvideDocumentCommand`:     true,
+	`\DeclareDocumentCommand`:     true,
+	`\NewDocumentEnvironment`:     true,
+	`\RenewDocumentEnvironment`:   true,
+	`\DeclareDocumentEnvironment`: true,
+}
+
+// unclassified are definitions that are reported if they define a command
+// without @ in its name.
+var unclassified = map[string]bool{
+	`\def`:  true,
+	`\gdef`: true,
+	`\edef`: true,
+	`\xdef`: true,
+	`\let`:  true,
+}
+
+// keyProperties are the property suffixes of \DeclareKeys.
+var keyProperties = map[string]bool{
+	"code":    true,
+	"store":   true,
+	"if":      true,
+	"ifnot":   true,
+	"usage":   true,
+	"default": true,
+	"choice":  true,
+	"choices": true,
+}
+
+// pgfPathHandlers are the pgfkeys handlers that do not define a key, but
+// change the current path or act on a family.
+var pgfPathHandlers = map[string]bool{
+	".cd":                true,
+	".is family":         true,
+	".search also":       true,
+	".unknown":           true,
+	".try":               true,
+	".retry":             true,
+	".get":               true,
+	".show value":        true,
+	".show code":         true,
+	".belongs to family": true,
+	".activate family":   true,
+	".deactivate family": true,
+}
+
+// extractor scans the code of a package source.
+type extractor struct {
+	texScanner
+	l      *Ltxref
+	pkg    *Package
+	report *ExtractReport
+}
+
+// ExtractPackage scans the LaTeX source of a package (.sty or .cls) and
+// creates a skeleton package name with the commands and options defined in
+// the source. Environments are added to the returned reference. For .dtx
+// files only the code between \begin{macrocode} and \end{macrocode} is read.
+func ExtractPackage(r io.Reader, name string) (*Ltxref, *ExtractReport, error) {
+	src, err := readLaTeXCode(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	e := &extractor{texScanner: texScanner{src: src}, l: &Ltxref{}, report: &ExtractReport{}}
+	if e.pkg, err = e.l.AddPackage(name); err != nil {
+		return nil, nil, err
+	}
+	e.scan()
+	sort.Sort(e.pkg.Commands)
+	sort.Sort(e.l.Environments)
+	sort.Strings(e.report.Keys)
+	return e.l, e.report, nil
+}
+
+// ExtractPackageFile extracts the definitions from filename. The package is
+// named after the file. For .cls files a document class with the declared
+// options is created as well.
+func ExtractPackageFile(filename string) (*Ltxref, *ExtractReport, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	ext := filepath.Ext(filename)
+	name := strings.TrimSuffix(filepath.Base(filename), ext)
+	l, report, err := ExtractPackage(f, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ext == ".cls" {
+		dc, err := l.AddDocumentClass(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		og := NewOptionGroup()
+		for _, po := range l.Packages[0].Options {
+			co := NewClassOption()
+			co.Name = po.Name
+			og.Classoption = append(og.Classoption, co)
+		}
+		if len(og.Classoption) > 0 {
+			dc.Optiongroup = append(dc.Optiongroup, og)
+		}
+	}
+	l.setOrigin(filename)
+	return l, report, nil
+}
+
+func (e *extractor) problem(start int, definition string, reason string) {
+	e.report.Unclassified = append(e.report.Unclassified, ExtractProblem{
+		Line:       e.lineno(start),
+		Definition: definition,
+		Reason:     reason,
+	})
+}
+
+func (e *extractor) scan() {
+	for e.pos < len(e.src) {
+		if e.src[e.pos] != '\\' {
+			e.pos++
+			continue
+		}
+		start := e.pos
+		cs := e.controlSequence()
+		switch {
+		case definers[cs]:
+			if err := e.definition(cs); err != nil {
+				e.problem(start, e.src[start:e.pos], err.Error())
+			}
+		case unclassified[cs]:
+			e.skipSpace()
+			name := e.src[e.pos:]
+			if strings.HasPrefix(name, "{") {
+				name = name[1:]
+			}
+			name = cwlCommandName(name)
+			if !strings.Contains(name, "@") {
+				e.problem(start, cs+name, "not analysed")
+			}
+		}
+	}
+}
+
+// csName reads a command name given as \foo or {\foo}.
+func (e *extractor) csName() (string, error) {
+	e.skipSpace()
+	if strings.HasPrefix(e.src[e.pos:], `\`) {
+		name := cwlCommandName(e.src[e.pos:])
+		e.pos += len(name)
+		return name, nil
+	}
+	name, ok, err := e.group('{', '}')
+	if err != nil {
+		return "", err
+	}
+	name = strings.TrimSpace(name)
+	if !ok || checkCommandName(name) != nil {
+		return "", fmt.Errorf("no command name")
+	}
+	return name, nil
+}
+
+func (e *extractor) definition(cs string) error {
+	if e.pos < len(e.src) && e.src[e.pos] == '*' {
+		e.pos++
+		if cs == `\DeclareOption` {
+			// the handler for undeclared options
+			_, _, err := e.group('{', '}')
+			return err
+		}
+	}
+	switch cs {
+	case `\newenvironment`, `\renewenvironment`, `\NewDocumentEnvironment`, `\RenewDocumentEnvironment`, `\DeclareDocumentEnvironment`:
+		name, ok, err := e.group('{', '}')
+		if err != nil || !ok {
+			return fmt.Errorf("no environment name")
+		}
+		args, err := e.arguments(cs)
+		if err != nil {
+			return err
+		}
+		if _, _, err = e.group('{', '}'); err != nil {
+			return err
+		}
+		if _, _, err = e.group('{', '}'); err != nil {
+			return err
+		}
+		if err = checkEnvironmentName(name); err != nil {
+			return err
+		}
+		env := e.l.GetEnvironmentWithName(name)
+		if env == nil {
+			if env, err = e.l.AddEnvironment(name); err != nil {
+				return err
+			}
+			v := NewVariant()
+			v.Name = name
+			v.Arguments = args
+			env.Variant = []Variant{*v}
+		}
+		return nil
+	case `\DeclareOption`:
+		name, ok, err := e.group('{', '}')
+		if err != nil || !ok {
+			return fmt.Errorf("no option name")
+		}
+		if _, _, err = e.group('{', '}'); err != nil {
+			return err
+		}
+		e.addOption(strings.TrimSpace(name))
+		return nil
+	case `\DeclareKeys`:
+		if _, _, err := e.group('[', ']'); err != nil {
+			return err
+		}
+		keys, ok, err := e.group('{', '}')
+		if err != nil || !ok {
+			return fmt.Errorf("no key list")
+		}
+		for _, key := range keyNames(keys) {
+			if i := strings.LastIndex(key, "."); i > 0 && keyProperties[strings.SplitN(key[i+1:], ":", 2)[0]] {
+				key = key[:i]
+			}
+			e.addOption(key)
+		}
+		return nil
+	case `\pgfkeys`, `\pgfqkeys`:
+		if cs == `\pgfqkeys` {
+			if _, ok, err := e.group('{', '}'); err != nil || !ok {
+				return fmt.Errorf("no key path")
+			}
+		}
+		keys, ok, err := e.group('{', '}')
+		if err != nil || !ok {
+			return fmt.Errorf("no key list")
+		}
+		for _, key := range keyNames(keys) {
+			key = pgfKeyName(key)
+			if key != "" && !hasTag(e.report.Keys, key) {
+				e.report.Keys = append(e.report.Keys, key)
+			}
+		}
+		return nil
+	}
+	// \newcommand and friends
+	name, err := e.csName()
+	if err != nil {
+		return err
+	}
+	args, err := e.arguments(cs)
+	if err != nil {
+		return err
+	}
+	if _, ok, err := e.group('{', '}'); err != nil || !ok {
+		return fmt.Errorf("no replacement text for %s", name)
+	}
+	if commandIndex(e.pkg.Commands, name) >= 0 {
+		return nil
+	}
+	cmd, err := e.l.AddCommand(name, e.pkg.Name)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(name, "@") {
+		cmd.Level = INTERNAL
+	}
+	v := NewVariant()
+	v.Name = name
+	v.Arguments = args
+	cmd.Variant = []Variant{*v}
+	return nil
+}
+
+// arguments reads the argument specification of a definition: the xparse
+// specification of \NewDocumentCommand and friends or the optional
+// [n][default] part of \newcommand. If there is a default value, the first
+// argument is optional.
+func (e *extractor) arguments(cs string) ([]*Argument, error) {
+	if strings.Contains(cs, "Document") {
+		spec, ok, err := e.group('{', '}')
+		if err != nil || !ok {
+			return nil, fmt.Errorf("no argument specification")
+		}
+		return ParseArgSpec(spec)
+	}
+	args := []*Argument{}
+	count, ok, err := e.group('[', ']')
+	if err != nil || !ok {
+		return args, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n < 0 || n > 9 {
+		return nil, fmt.Errorf("invalid number of arguments %q", count)
+	}
+	def, hasDefault, err := e.group('[', ']')
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= n; i++ {
+		arg := NewArgument()
+		arg.Name = "arg" + strconv.Itoa(i)
+		arg.Type = MANDARG
+		if i == 1 && hasDefault {
+			arg.Type = OPTARG
+			arg.Optional = true
+			arg.Default = def
+			arg.HasDefault = true
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func (e *extractor) addOption(name string) {
+	if name == "" {
+		return
+	}
+	for _, po := range e.pkg.Options {
+		if po.Name == name {
+			return
+		}
+	}
+	po := NewPackageOption()
+	po.Name = name
+	e.pkg.Options = append(e.pkg.Options, po)
+}
+
+// pgfKeyName returns the name of the key that a pgfkeys path such as
+// /my/width/.store in defines, or "" if the path ends in a handler like .cd
+// that does not define a key.
+func pgfKeyName(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		seg = strings.TrimSpace(seg)
+		if !strings.HasPrefix(seg, ".") {
+			continue
+		}
+		if i == 0 || pgfPathHandlers[seg] {
+			return ""
+		}
+		return strings.TrimSpace(segments[i-1])
+	}
+	return strings.TrimSpace(segments[len(segments)-1])
+}
+
+// keyNames returns the names in a comma separated key=value list.
+func keyNames(list string) []string {
+	var names []string
+	for _, item := range splitKeyvals(list) {
+		if i := strings.Index(item, "="); i >= 0 {
+			item = strings.TrimSpace(item[:i])
+		}
+		if item != "" {
+			names = append(names, item)
+		}
+	}
+	return names
+}
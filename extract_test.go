@@ -0,0 +1,100 @@
+package ltxref
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPgfKeyName(t *testing.T) {
+	tests := []struct {
+		path string
+		key  string
+	}{
+		{"width", "width"},
+		{"/my/width", "width"},
+		{"width/.store in", "width"},
+		{"/my/height/.code", "height"},
+		{" style /.style ", "style"},
+		{"/my/.cd", ""},
+		{".cd", ""},
+		{"/my/.is family", ""},
+		{"/my/.search also", ""},
+		{"/my/.unknown/.code", ""},
+		{"/.store in", ""},
+	}
+	for _, tt := range tests {
+		if got := pgfKeyName(tt.path); got != tt.key {
+			t.Errorf("pgfKeyName(%q) = %q, want %q", tt.path, got, tt.key)
+		}
+	}
+}
+
+const testDtx = `% \iffalse
+%<*driver>
+\documentclass{ltxdoc}
+%</driver>
+% \fi
+% \begin{macro}{\mycmd}
+% The documentation shows \newcommand\notdefined{x}.
+%    \begin{macrocode}
+\newcommand\mycmd[2][left]{#1 #2}% a comment \newcommand\commented{}
+\newcommand*{\mytwo}[1]{#1}
+\NewDocumentCommand\myxparse{s O{x} m}{}
+\newenvironment{myenv}[1]{}{}
+\def\my@internal{}
+\def\myraw{}
+%    \end{macrocode}
+% \end{macro}
+%    \begin{macrocode}
+\DeclareOption{draft}{}
+\DeclareKeys[mypkg]{
+  width.store = \my@width,
+  mode.choice:,
+  verbose.if = my@verbose,
+}
+\pgfkeys{/my/.cd, width/.store in=\w, height=2cm, /my/.is family}
+\pgfqkeys{/my}{color/.code={}, .search also={/tikz}}
+%    \end{macrocode}
+`
+
+func TestExtractPackage(t *testing.T) {
+	l, report, err := ExtractPackage(strings.NewReader(testDtx), "mypkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := l.GetPackageWithName("mypkg")
+	var names []string
+	for _, cmd := range pkg.Commands {
+		names = append(names, cmd.Name)
+	}
+	if want := []string{`\mycmd`, `\mytwo`, `\myxparse`}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got commands %v, want %v", names, want)
+	}
+	args := l.GetCommandFromPackage(`\mycmd`, "mypkg").Variant[0].Arguments
+	if len(args) != 2 || args[0].Type != OPTARG || !args[0].Optional || args[0].Default != "left" || args[1].Type != MANDARG {
+		t.Errorf(`\mycmd: got arguments %v`, args)
+	}
+	if args := l.GetCommandFromPackage(`\mytwo`, "mypkg").Variant[0].Arguments; len(args) != 1 || args[0].Type != MANDARG {
+		t.Errorf(`\mytwo: got arguments %v`, args)
+	}
+	if args := l.GetCommandFromPackage(`\myxparse`, "mypkg").Variant[0].Arguments; len(args) != 3 {
+		t.Errorf(`\myxparse: got arguments %v`, args)
+	}
+	if env := l.GetEnvironmentWithName("myenv"); env == nil || len(env.Variant[0].Arguments) != 1 {
+		t.Errorf("myenv: got %v", env)
+	}
+	var options []string
+	for _, po := range pkg.Options {
+		options = append(options, po.Name)
+	}
+	if want := []string{"draft", "width", "mode", "verbose"}; !reflect.DeepEqual(options, want) {
+		t.Errorf("got options %v, want %v", options, want)
+	}
+	if want := []string{"color", "height", "width"}; !reflect.DeepEqual(report.Keys, want) {
+		t.Errorf("got keys %v, want %v", report.Keys, want)
+	}
+	if len(report.Unclassified) != 1 || report.Unclassified[0].Definition != `\def\myraw` || report.Unclassified[0].Line != 14 {
+		t.Errorf("got unclassified %v", report.Unclassified)
+	}
+}
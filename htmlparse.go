@@ -0,0 +1,89 @@
+package ltxref
+
+import (
+	"encoding/xml"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// htmlNode is a node of a parsed description. Text nodes have an empty name.
+type htmlNode struct {
+	name     string
+	attr     map[string]string
+	text     string
+	children []*htmlNode
+}
+
+// parseHTML parses the HTML of a description into a tree. The parser is
+// lenient (unclosed tags, HTML entities), so descriptions that are not well
+// formed still give a usable result.
+func parseHTML(in template.HTML) *htmlNode {
+	root := &htmlNode{name: "#root"}
+	stack := []*htmlNode{root}
+	dec := xml.NewDecoder(strings.NewReader(string(in)))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			if err != io.EOF {
+				// keep the rest as text
+				stack[0].children = append(stack[0].children, &htmlNode{text: string(in)[dec.InputOffset():]})
+			}
+			break
+		}
+		cur := stack[len(stack)-1]
+		switch v := t.(type) {
+		case xml.StartElement:
+			n := &htmlNode{name: strings.ToLower(v.Name.Local), attr: make(map[string]string)}
+			for _, attribute := range v.Attr {
+				n.attr[strings.ToLower(attribute.Name.Local)] = attribute.Value
+			}
+			cur.children = append(cur.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			name := strings.ToLower(v.Name.Local)
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+		case xml.CharData:
+			cur.children = append(cur.children, &htmlNode{text: string(v)})
+		}
+	}
+	return root
+}
+
+// collapseSpace replaces all runs of white space by a single space.
+func collapseSpace(s string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			if !space {
+				sb.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// textContent returns the concatenated text of the node and its children.
+func (n *htmlNode) textContent() string {
+	if n.name == "" {
+		return n.text
+	}
+	var sb strings.Builder
+	for _, c := range n.children {
+		sb.WriteString(c.textContent())
+	}
+	return sb.String()
+}
@@ -0,0 +1,351 @@
+package ltxref
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	sitetpl *template.Template
+)
+
+func init() {
+	funcMap := template.FuncMap{
+		"slug":     slug,
+		"tagpage":  tagPage,
+		"pkgpage":  packagePage,
+		"dashname": url.PathEscape,
+		"examples": examplesForLang,
+	}
+	sitetpl = template.Must(template.New("site.html").Funcs(funcMap).Parse(string(MustAsset("templates/site.html"))))
+}
+
+// siteEntry is an entry in a list of the static site and in the search
+// index. URL is relative to the root of the site and has no extension.
+type siteEntry struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Package string `json:"package,omitempty"`
+	URL     string `json:"url"`
+	Short   string `json:"short"`
+}
+
+type siteGroup struct {
+	Title   string
+	Entries []siteEntry
+}
+
+type siteDep struct {
+	Package  *Package
+	Loads    []siteEntry
+	LoadedBy []siteEntry
+}
+
+// sitePageData is passed to the templates of the static site.
+type sitePageData struct {
+	Title   string
+	Root    string
+	Lang    string
+	Version string
+	Labels  []string
+	// Add the table of contents anchors for Dash
+	Dash bool
+
+	Command     *Command
+	Environment *Environment
+	Class       *DocumentClass
+	Package     *Package
+
+	SeeAlso []siteEntry
+	Entries []siteEntry
+	Groups  []siteGroup
+	Deps    []siteDep
+}
+
+type htmlSite struct {
+	*siteLayout
+	dir  string
+	lang string
+	dash bool
+}
+
+// WriteHTML writes the reference as a static HTML site into dir. The site has
+// a page for each command, environment, document class, package and tag, an
+// alphabetical index and a page with the package dependencies. The search
+// runs in the browser with the index in search.json (also included as
+// search-index.js, so the site works from the file system without a web
+// server). All assets are written to dir, the output only depends on the
+// reference, so it can be kept under version control. lang is the language of
+// the descriptions.
+func (l *Ltxref) WriteHTML(dir string, lang string) error {
+	return newHTMLSite(l, dir, lang).write()
+}
+
+func newHTMLSite(l *Ltxref, dir string, lang string) *htmlSite {
+	return &htmlSite{siteLayout: newSiteLayout(l), dir: dir, lang: lang}
+}
+
+func (hs *htmlSite) write() error {
+	l := hs.l
+	var err error
+	for _, cmd := range l.Commands {
+		if err = hs.writeCommand(commandPage(cmd), cmd, nil); err != nil {
+			return err
+		}
+	}
+	for _, env := range l.Environments {
+		page := environmentPage(env)
+		data := hs.pageData(page, env.Name)
+		data.Environment = env
+		data.Labels = siteTags(env.Label)
+		data.SeeAlso = hs.seeAlsoEntries(env.SeeAlso)
+		if err = hs.render(page, "siteenvironment", data); err != nil {
+			return err
+		}
+	}
+	for _, dc := range l.DocumentClasses {
+		page := classPage(dc)
+		data := hs.pageData(page, dc.Name)
+		data.Class = dc
+		data.Labels = siteTags(dc.Label)
+		if err = hs.render(page, "siteclass", data); err != nil {
+			return err
+		}
+	}
+	for _, pkg := range l.Packages {
+		page := packagePage(pkg)
+		data := hs.pageData(page, pkg.Name)
+		data.Package = pkg
+		data.Labels = siteTags(pkg.Label)
+		for _, cmd := range pkg.Commands {
+			data.Entries = append(data.Entries, hs.commandEntry(cmd, pkg))
+		}
+		if err = hs.render(page, "sitepackage", data); err != nil {
+			return err
+		}
+		for _, cmd := range pkg.Commands {
+			if err = hs.writeCommand(packageCommandPage(pkg, cmd), cmd, pkg); err != nil {
+				return err
+			}
+		}
+	}
+	for _, tag := range siteTags(l.Tags()) {
+		page := tagPage(tag)
+		data := hs.pageData(page, tag)
+		var entries []siteEntry
+		for _, e := range hs.allEntries() {
+			if hasTag(e.labels, tag) {
+				entries = append(entries, e.siteEntry)
+			}
+		}
+		data.Groups = []siteGroup{{Entries: entries}}
+		if err = hs.render(page, "sitelist", data); err != nil {
+			return err
+		}
+	}
+	if err = hs.writeIndex(); err != nil {
+		return err
+	}
+	if err = hs.writeAlphabetical(); err != nil {
+		return err
+	}
+	if err = hs.writeDependencies(); err != nil {
+		return err
+	}
+	return hs.writeAssets()
+}
+
+func (hs *htmlSite) pageData(page string, title string) *sitePageData {
+	return &sitePageData{
+		Title:   title,
+		Root:    relative(page, ""),
+		Lang:    hs.lang,
+		Version: hs.l.Version,
+		Dash:    hs.dash,
+	}
+}
+
+func (hs *htmlSite) render(page string, tplname string, data *sitePageData) error {
+	var buf bytes.Buffer
+	if err := sitetpl.ExecuteTemplate(&buf, tplname, data); err != nil {
+		return err
+	}
+	return writePage(hs.dir, page+".html", buf.Bytes())
+}
+
+func (hs *htmlSite) writeCommand(page string, cmd *Command, pkg *Package) error {
+	data := hs.pageData(page, cmd.Name)
+	data.Command = cmd
+	data.Package = pkg
+	data.Labels = siteTags(cmd.Label)
+	data.SeeAlso = hs.seeAlsoEntries(cmd.SeeAlso)
+	return hs.render(page, "sitecommand", data)
+}
+
+func (hs *htmlSite) seeAlsoEntries(names []string) []siteEntry {
+	var entries []siteEntry
+	for _, name := range names {
+		entries = append(entries, siteEntry{Name: name, URL: hs.seealso[name]})
+	}
+	return entries
+}
+
+func (hs *htmlSite) commandEntry(cmd *Command, pkg *Package) siteEntry {
+	e := siteEntry{Name: cmd.Name, Kind: "command", URL: commandPage(cmd), Short: cmd.ShortDescription[hs.lang]}
+	if pkg != nil {
+		e.Package = pkg.Name
+		e.URL = packageCommandPage(pkg, cmd)
+	}
+	return e
+}
+
+// labeledEntry is a site entry with the labels of the referenced entry.
+type labeledEntry struct {
+	siteEntry
+	labels []string
+}
+
+// allEntries returns all entries of the reference in the order of the
+// reference.
+func (hs *htmlSite) allEntries() []labeledEntry {
+	var entries []labeledEntry
+	l := hs.l
+	for _, cmd := range l.Commands {
+		entries = append(entries, labeledEntry{hs.commandEntry(cmd, nil), cmd.Label})
+	}
+	for _, env := range l.Environments {
+		entries = append(entries, labeledEntry{siteEntry{Name: env.Name, Kind: "environment", URL: environmentPage(env), Short: env.ShortDescription[hs.lang]}, env.Label})
+	}
+	for _, dc := range l.DocumentClasses {
+		entries = append(entries, labeledEntry{siteEntry{Name: dc.Name, Kind: "documentclass", URL: classPage(dc), Short: dc.ShortDescription[hs.lang]}, dc.Label})
+	}
+	for _, pkg := range l.Packages {
+		entries = append(entries, labeledEntry{siteEntry{Name: pkg.Name, Kind: "package", URL: packagePage(pkg), Short: pkg.ShortDescription[hs.lang]}, pkg.Label})
+		for _, cmd := range pkg.Commands {
+			entries = append(entries, labeledEntry{hs.commandEntry(cmd, pkg), cmd.Label})
+		}
+	}
+	return entries
+}
+
+func (hs *htmlSite) writeIndex() error {
+	page := "index"
+	data := hs.pageData(page, "LaTeX reference")
+	groups := map[string]*siteGroup{}
+	titles := []string{"Commands", "Environments", "Document classes", "Packages"}
+	kinds := map[string]string{"command": "Commands", "environment": "Environments", "documentclass": "Document classes", "package": "Packages"}
+	for _, title := range titles {
+		groups[title] = &siteGroup{Title: title}
+	}
+	for _, e := range hs.allEntries() {
+		if e.Package != "" {
+			// package commands are listed on the package page
+			continue
+		}
+		g := groups[kinds[e.Kind]]
+		g.Entries = append(g.Entries, e.siteEntry)
+	}
+	for _, title := range titles {
+		if len(groups[title].Entries) > 0 {
+			data.Groups = append(data.Groups, *groups[title])
+		}
+	}
+	tags := siteGroup{Title: "Tags"}
+	for _, tag := range siteTags(hs.l.Tags()) {
+		tags.Entries = append(tags.Entries, siteEntry{Name: tag, Kind: "tag", URL: tagPage(tag)})
+	}
+	if len(tags.Entries) > 0 {
+		data.Groups = append(data.Groups, tags)
+	}
+	return hs.render(page, "sitelist", data)
+}
+
+// writeAlphabetical writes all entries sorted by name and grouped by the
+// first letter (ignoring the backslash of commands).
+func (hs *htmlSite) writeAlphabetical() error {
+	page := "alphabetical"
+	data := hs.pageData(page, "Alphabetical index")
+	var entries []siteEntry
+	for _, e := range hs.allEntries() {
+		entries = append(entries, e.siteEntry)
+	}
+	sortkey := func(e siteEntry) string {
+		return strings.ToLower(strings.TrimPrefix(e.Name, `\`))
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		ki, kj := sortkey(entries[i]), sortkey(entries[j])
+		if ki != kj {
+			return ki < kj
+		}
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Package < entries[j].Package
+	})
+	for _, e := range entries {
+		r, _ := utf8.DecodeRuneInString(sortkey(e))
+		letter := string(unicode.ToUpper(r))
+		if !unicode.IsLetter(r) {
+			letter = "#"
+		}
+		if len(data.Groups) == 0 || data.Groups[len(data.Groups)-1].Title != letter {
+			data.Groups = append(data.Groups, siteGroup{Title: letter})
+		}
+		g := &data.Groups[len(data.Groups)-1]
+		g.Entries = append(g.Entries, e)
+	}
+	return hs.render(page, "sitelist", data)
+}
+
+// writeDependencies writes the page with the packages each package loads and
+// is loaded by.
+func (hs *htmlSite) writeDependencies() error {
+	page := "dependencies"
+	data := hs.pageData(page, "Package dependencies")
+	loadedby := make(map[string][]siteEntry)
+	for _, pkg := range hs.l.Packages {
+		for _, name := range pkg.LoadsPackages {
+			loadedby[name] = append(loadedby[name], siteEntry{Name: pkg.Name, URL: packagePage(pkg)})
+		}
+	}
+	for _, pkg := range hs.l.Packages {
+		dep := siteDep{Package: pkg, LoadedBy: loadedby[pkg.Name]}
+		for _, name := range pkg.LoadsPackages {
+			e := siteEntry{Name: name}
+			if p := hs.l.GetPackageWithName(name); p != nil {
+				e.URL = packagePage(p)
+			}
+			dep.Loads = append(dep.Loads, e)
+		}
+		data.Deps = append(data.Deps, dep)
+	}
+	return hs.render(page, "sitedeps", data)
+}
+
+func (hs *htmlSite) writeAssets() error {
+	var entries []siteEntry
+	for _, e := range hs.allEntries() {
+		entries = append(entries, e.siteEntry)
+	}
+	index, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err = writePage(hs.dir, "search.json", index); err != nil {
+		return err
+	}
+	js := append(append([]byte("var ltxrefSearchIndex = "), index...), ";\n"...)
+	if err = writePage(hs.dir, "search-index.js", js); err != nil {
+		return err
+	}
+	if err = writePage(hs.dir, "search.js", MustAsset("templates/search.js")); err != nil {
+		return err
+	}
+	return writePage(hs.dir, "site.css", MustAsset("templates/site.css"))
+}
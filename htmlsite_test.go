@@ -0,0 +1,35 @@
+package ltxref
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTMLEmptyLabel(t *testing.T) {
+	r := emptyLabelRef(t)
+	dir := t.TempDir()
+	if err := r.WriteHTML(dir, "en"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "tags"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "font.html" {
+		for _, e := range entries {
+			t.Log(e.Name())
+		}
+		t.Error("want only tags/font.html")
+	}
+	for _, page := range []string{"index.html", "commands/section.html"} {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(page)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "tags/_.html") {
+			t.Errorf("%s links to the empty tag", page)
+		}
+	}
+}
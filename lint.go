@@ -0,0 +1,412 @@
+package ltxref
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// A LintMessage is a problem found in a LaTeX document.
+type LintMessage struct {
+	Line    int
+	Command string
+	Message string
+}
+
+func (m LintMessage) String() string {
+	return fmt.Sprintf("line %d: %s: %s", m.Line, m.Command, m.Message)
+}
+
+// linter checks a LaTeX document against the reference.
+type linter struct {
+	texScanner
+	l        *Ltxref
+	context  *contextTracker
+	messages []LintMessage
+}
+
+var (
+	dimensionRE = regexp.MustCompile(`^[-+]?(\d+(\.\d*)?|\.\d+)?\s*(pt|mm|cm|in|ex|em|bp|pc|dd|cc|sp|nd|nc|mu|px|\\[a-zA-Z@]+)$`)
+	integerRE   = regexp.MustCompile(`^[-+]?\d+$`)
+)
+
+// Lint reads a LaTeX document and checks the key value lists of the
+// commands against the keys in the reference, the options of \usepackage
+// against the package options and the options of \documentclass against the
+// class options. Deprecated and removed commands, environments, packages and
+// options are reported as well as commands and environments that are used
+// in the wrong mode or outside of their parent environments (the preamble
+// is not checked for these, because it contains definitions).
+func (l *Ltxref) Lint(r io.Reader) ([]LintMessage, error) {
+	src, err := readLaTeXCode(r)
+	if err != nil {
+		return nil, err
+	}
+	lt := &linter{texScanner: texScanner{src: src}, l: l, context: newContextTracker(l, src)}
+	lt.scan()
+	return lt.messages, nil
+}
+
+func (lt *linter) message(pos int, cmd string, format string, a ...interface{}) {
+	lt.messages = append(lt.messages, LintMessage{
+		Line:    lt.lineno(pos),
+		Command: cmd,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// deprecated adds a message if the history of the entry what says that it is
+// deprecated or removed.
+func (lt *linter) deprecated(pos int, cmd string, what string, h History) {
+	if !h.IsDeprecated() {
+		return
+	}
+	var msg string
+	switch {
+	case h.Removed != "":
+		msg = fmt.Sprintf("%s has been removed in %s", what, h.Removed)
+	case h.Deprecated != "":
+		msg = fmt.Sprintf("%s is deprecated since %s", what, h.Deprecated)
+	}
+	if h.ReplacedBy != "" {
+		msg += ", use " + h.ReplacedBy + " instead"
+	}
+	lt.message(pos, cmd, "%s", msg)
+}
+
+// environment checks the environment of \begin{name} in the context.
+func (lt *linter) environment(start int, ctx Context) {
+	name, ok, err := lt.group('{', '}')
+	if err != nil || !ok {
+		return
+	}
+	name = strings.TrimSpace(name)
+	env := lt.l.GetEnvironmentWithName(name)
+	if env == nil {
+		env = lt.l.GetEnvironmentWithName(strings.TrimSuffix(name, "*"))
+	}
+	if env == nil {
+		return
+	}
+	if msg := contextProblem(env.Modes, env.Parents, ctx); msg != "" {
+		lt.message(start, `\begin`, "environment %s: %s", name, msg)
+	}
+	lt.deprecated(start, `\begin`, "environment "+env.Name, env.History)
+	for _, v := range env.Variant {
+		if v.Name == name && v.Name != env.Name {
+			lt.deprecated(start, `\begin`, "environment "+name, v.History)
+		}
+	}
+}
+
+func (lt *linter) scan() {
+	for lt.pos < len(lt.src) {
+		if lt.src[lt.pos] != '\\' {
+			lt.pos++
+			continue
+		}
+		start := lt.pos
+		name := cwlCommandName(lt.src[lt.pos:])
+		lt.pos += len(name)
+		after := lt.pos
+		ctx := lt.context.at(start)
+		cmd := lt.l.lookupCommand(strings.TrimSuffix(name, "*"))
+		if cmd != nil {
+			if msg := contextProblem(cmd.Modes, cmd.Parents, ctx); msg != "" {
+				lt.message(start, name, "%s", msg)
+			}
+			lt.deprecated(start, name, name, cmd.History)
+			if v := lookupVariant(cmd, name); v != nil && v.Name == name && v.Name != cmd.Name {
+				lt.deprecated(start, name, name, v.History)
+			}
+		}
+		switch name {
+		case `\usepackage`, `\RequirePackage`:
+			lt.usepackage(start, name)
+			continue
+		case `\documentclass`:
+			lt.documentclass(start, name)
+			continue
+		case `\begin`:
+			lt.environment(start, ctx)
+			lt.pos = after
+		}
+		if cmd == nil {
+			continue
+		}
+		lt.arguments(start, name, cmd)
+		// the arguments may contain commands as well
+		lt.pos = after
+	}
+}
+
+// usepackage checks the options of \usepackage[options]{packages} against
+// the options of the packages. Packages that are not in the reference or
+// have no documented options are not checked.
+func (lt *linter) usepackage(start int, cmdname string) {
+	options, _, err := lt.group('[', ']')
+	if err != nil {
+		return
+	}
+	names, ok, err := lt.group('{', '}')
+	if err != nil || !ok {
+		return
+	}
+	for _, pkgname := range strings.Split(names, ",") {
+		pkg := lt.l.GetPackageWithName(strings.TrimSpace(pkgname))
+		if pkg == nil {
+			continue
+		}
+		lt.deprecated(start, cmdname, "package "+pkg.Name, pkg.History)
+		if len(pkg.Options) == 0 {
+			continue
+		}
+		for _, item := range splitKeyvals(options) {
+			name, value, hasValue := splitKeyval(item)
+			var po *Packageoption
+			for _, o := range pkg.Options {
+				if o.Name == name {
+					po = o
+					break
+				}
+			}
+			if po == nil {
+				lt.message(start, cmdname, "package %s: unknown option %q", pkg.Name, name)
+				continue
+			}
+			if msg := po.checkValue(value, hasValue); msg != "" {
+				lt.message(start, cmdname, "package %s: option %s: %s", pkg.Name, name, msg)
+			}
+			lt.deprecated(start, cmdname, fmt.Sprintf("package %s: option %s", pkg.Name, name), po.History)
+		}
+	}
+}
+
+// documentclass checks the options of \documentclass[options]{class} if
+// the class is in the reference.
+func (lt *linter) documentclass(start int, cmdname string) {
+	options, _, err := lt.group('[', ']')
+	if err != nil {
+		return
+	}
+	class, ok, err := lt.group('{', '}')
+	if err != nil || !ok || lt.l.GetDocumentClass(strings.TrimSpace(class)) == nil {
+		return
+	}
+	effective, err := lt.l.ResolveOptions(strings.TrimSpace(class), splitKeyvals(options))
+	if err != nil {
+		lt.message(start, cmdname, "%s", err)
+	}
+	for _, eo := range effective {
+		if eo.Option != nil && !eo.Implied {
+			lt.deprecated(start, cmdname, "option "+eo.Name, eo.Option.History)
+		}
+	}
+}
+
+// lookupCommand returns the kernel command or the first package command
+// with the name.
+func (l *Ltxref) lookupCommand(name string) *Command {
+	if i := commandIndex(l.Commands, name); i >= 0 {
+		return l.Commands[i]
+	}
+	for _, pkg := range l.Packages {
+		if i := commandIndex(pkg.Commands, name); i >= 0 {
+			return pkg.Commands[i]
+		}
+	}
+	return nil
+}
+
+// lookupVariant returns the variant with the name or the first variant.
+func lookupVariant(cmd *Command, name string) *Variant {
+	for i := range cmd.Variant {
+		if cmd.Variant[i].Name == name {
+			return &cmd.Variant[i]
+		}
+	}
+	if len(cmd.Variant) > 0 {
+		return &cmd.Variant[0]
+	}
+	return nil
+}
+
+// arguments reads the arguments of the command at start and checks the key
+// value lists.
+func (lt *linter) arguments(start int, name string, cmd *Command) {
+	v := lookupVariant(cmd, name)
+	if v == nil {
+		return
+	}
+	for _, arg := range v.Arguments {
+		var content string
+		var ok bool
+		var err error
+		switch arg.Type {
+		case OPTARG, OPTLIST, KEYVALLIST, MANDARG, MANDLIST:
+			if arg.Optional {
+				content, ok, err = lt.group('[', ']')
+				if !ok && err == nil {
+					continue
+				}
+			} else {
+				content, ok, err = lt.group('{', '}')
+			}
+		case STAR, TOKEN:
+			lt.skipSpace()
+			tok := arg.Delimiters
+			if arg.Type == STAR {
+				tok = "*"
+			}
+			if strings.HasPrefix(lt.src[lt.pos:], tok) {
+				lt.pos += len(tok)
+			}
+			continue
+		case DELIMITED:
+			open, closing := splitDelimiters(arg.Delimiters)
+			if len(open) != 1 || len(closing) != 1 {
+				return
+			}
+			_, ok, err = lt.group(open[0], closing[0])
+			if !ok && err == nil && arg.Optional {
+				continue
+			}
+		case EMBELLISHMENT:
+			lt.skipSpace()
+			if !strings.HasPrefix(lt.src[lt.pos:], arg.Delimiters) {
+				continue
+			}
+			lt.pos += len(arg.Delimiters)
+			_, ok, err = lt.group('{', '}')
+		default:
+			// verbatim, body and TeX primitive syntax are not checked
+			return
+		}
+		if err != nil || !ok {
+			return
+		}
+		if arg.Type == KEYVALLIST && len(arg.Keys) > 0 {
+			lt.checkKeyvals(start, name, content, arg.Keys)
+		}
+	}
+}
+
+// checkKeyvals checks a key=value list against the keys.
+func (lt *linter) checkKeyvals(start int, cmdname string, list string, keys []*Key) {
+	for _, item := range splitKeyvals(list) {
+		name, value, hasValue := splitKeyval(item)
+		var key *Key
+		for _, k := range keys {
+			if k.Name == name {
+				key = k
+				break
+			}
+		}
+		if key == nil {
+			lt.message(start, cmdname, "unknown key %q", name)
+			continue
+		}
+		if msg := key.checkValue(value, hasValue); msg != "" {
+			lt.message(start, cmdname, "key %s: %s", name, msg)
+		}
+	}
+}
+
+// checkValue returns an error message if the value is not valid for the key.
+func (k *Key) checkValue(value string, hasValue bool) string {
+	if !hasValue {
+		if k.Type == BOOLEANVALUE || k.Default != "" {
+			return ""
+		}
+		return "value missing"
+	}
+	return checkTypedValue(k.Type, k.Choices, value)
+}
+
+// checkValue returns an error message if the value is not valid for the
+// option.
+func (ov OptionValue) checkValue(value string, hasValue bool) string {
+	if ov.Kind == FLAGOPTION {
+		if hasValue {
+			return "option takes no value"
+		}
+		return ""
+	}
+	if !hasValue {
+		if ov.DefaultValue != "" {
+			return ""
+		}
+		return "value missing"
+	}
+	if ov.Kind == CHOICEOPTION {
+		return checkTypedValue(CHOICEVALUE, ov.Values, value)
+	}
+	return checkTypedValue(ov.Type, ov.Values, value)
+}
+
+// checkTypedValue returns an error message if the value does not match the
+// value type.
+func checkTypedValue(vt Valuetype, choices []string, value string) string {
+	switch vt {
+	case DIMENSIONVALUE:
+		if !dimensionRE.MatchString(value) && !strings.HasPrefix(value, `\`) {
+			return fmt.Sprintf("%q is not a dimension", value)
+		}
+	case INTEGERVALUE:
+		if !integerRE.MatchString(value) && !strings.HasPrefix(value, `\`) {
+			return fmt.Sprintf("%q is not an integer", value)
+		}
+	case BOOLEANVALUE:
+		if value != "true" && value != "false" {
+			return fmt.Sprintf("%q is not true or false", value)
+		}
+	case CHOICEVALUE:
+		if !hasTag(choices, value) {
+			return fmt.Sprintf("%q is not one of %s", value, strings.Join(choices, ", "))
+		}
+	}
+	return ""
+}
+
+// splitKeyval splits an item of a key value list into the key and the value.
+// Braces around the value are removed.
+func splitKeyval(item string) (string, string, bool) {
+	i := strings.Index(item, "=")
+	if i < 0 {
+		return strings.TrimSpace(item), "", false
+	}
+	value := strings.TrimSpace(item[i+1:])
+	if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+		value = value[1 : len(value)-1]
+	}
+	return strings.TrimSpace(item[:i]), value, true
+}
+
+// splitKeyvals splits a key value list at the commas outside of braces and
+// drops empty items.
+func splitKeyvals(list string) []string {
+	var items []string
+	depth := 0
+	start := 0
+	add := func(item string) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(list[start:i])
+				start = i + 1
+			}
+		}
+	}
+	add(list[start:])
+	return items
+}
@@ -0,0 +1,438 @@
+package ltxref
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// roffEscape escapes text for roff.
+func roffEscape(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+	return s
+}
+
+// roffWriter converts parsed HTML to roff with the man macros.
+type roffWriter struct {
+	buf bytes.Buffer
+	// the current line has text
+	inline bool
+	pre    bool
+}
+
+// macro starts a new line with the macro.
+func (w *roffWriter) macro(m string) {
+	if w.inline {
+		w.buf.WriteByte('\n')
+		w.inline = false
+	}
+	w.buf.WriteString(m)
+	w.buf.WriteByte('\n')
+}
+
+func (w *roffWriter) text(s string) {
+	if !w.pre {
+		s = collapseSpace(s)
+		if !w.inline {
+			s = strings.TrimLeft(s, " ")
+		}
+	}
+	if s == "" {
+		return
+	}
+	s = roffEscape(s)
+	if !w.inline && (strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'")) {
+		// would be read as a control line
+		w.buf.WriteString(`\&`)
+	}
+	if w.pre {
+		s = strings.Replace(s, "\n.", "\n\\&.", -1)
+		s = strings.Replace(s, "\n'", "\n\\&'", -1)
+	}
+	w.buf.WriteString(s)
+	w.inline = !strings.HasSuffix(s, "\n")
+}
+
+func (w *roffWriter) children(n *htmlNode) {
+	for _, c := range n.children {
+		w.node(c)
+	}
+}
+
+func (w *roffWriter) node(n *htmlNode) {
+	switch n.name {
+	case "":
+		w.text(n.text)
+	case "p", "div", "blockquote", "table", "h1", "h2", "h3", "h4", "h5", "h6":
+		w.macro(".PP")
+		w.children(n)
+		w.macro(".PP")
+	case "br", "tr":
+		w.macro(".br")
+		w.children(n)
+	case "em", "i", "var":
+		w.buf.WriteString(`\fI`)
+		w.children(n)
+		w.buf.WriteString(`\fP`)
+	case "strong", "b", "code", "tt", "kbd", "samp":
+		w.buf.WriteString(`\fB`)
+		w.children(n)
+		w.buf.WriteString(`\fP`)
+	case "cmd":
+		w.text(n.attr["name"])
+	case "pre":
+		w.macro(".PP")
+		w.macro(".RS 4")
+		w.macro(".nf")
+		w.pre = true
+		w.text(strings.Trim(n.textContent(), "\n"))
+		w.pre = false
+		w.macro(".fi")
+		w.macro(".RE")
+		w.macro(".PP")
+	case "ul", "ol":
+		for i, li := range n.children {
+			if li.name != "li" {
+				continue
+			}
+			if n.name == "ol" {
+				w.macro(fmt.Sprintf(".IP %d. 4", i+1))
+			} else {
+				w.macro(`.IP \(bu 2`)
+			}
+			w.children(li)
+		}
+		w.macro(".PP")
+	default:
+		w.children(n)
+	}
+}
+
+// htmlToRoff converts a description to roff.
+func htmlToRoff(in template.HTML) string {
+	w := &roffWriter{}
+	w.children(parseHTML(in))
+	if w.inline {
+		w.buf.WriteByte('\n')
+	}
+	// remove empty and duplicate paragraph macros
+	var lines []string
+	for _, line := range strings.Split(w.buf.String(), "\n") {
+		if line == ".PP" && (len(lines) == 0 || lines[len(lines)-1] == ".PP") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && (lines[len(lines)-1] == ".PP" || lines[len(lines)-1] == "") {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// roffArgument returns the argument for the SYNOPSIS, the name of the
+// argument in italics.
+func roffArgument(a *Argument) string {
+	name := `\fI` + roffEscape(a.Name) + `\fP`
+	switch a.Type {
+	case OPTARG:
+		return "[" + name + "]"
+	case OPTLIST:
+		return "[" + name + ",...]"
+	case MANDARG:
+		return "{" + name + "}"
+	case MANDLIST:
+		return "{" + name + ",...}"
+	case TODIMENORSPREADDIMEN:
+		return " to " + name
+	case KEYVALLIST:
+		return "[" + name + "=...]"
+	case STAR:
+		return "*"
+	case TOKEN:
+		return roffEscape(a.Delimiters)
+	case DELIMITED:
+		open, closing := splitDelimiters(a.Delimiters)
+		return roffEscape(open) + name + roffEscape(closing)
+	case VERBATIM:
+		return "|" + name + "|"
+	case EMBELLISHMENT:
+		return roffEscape(a.Delimiters) + "{" + name + "}"
+	case BODY:
+		return ""
+	}
+	return name
+}
+
+// manPages knows the name of the man page for each entry.
+type manPages struct {
+	l    *Ltxref
+	lang string
+	// the man page for a name in a see also list
+	seealso map[string]string
+}
+
+func newManPages(l *Ltxref, lang string) *manPages {
+	mp := &manPages{l: l, lang: lang, seealso: make(map[string]string)}
+	// a command defined in several packages refers to the first package
+	for i := len(l.Packages) - 1; i >= 0; i-- {
+		pkg := l.Packages[i]
+		for _, cmd := range pkg.Commands {
+			mp.seealso[cmd.Name] = mp.packageCommandPage(pkg, cmd)
+		}
+	}
+	for _, env := range l.Environments {
+		mp.seealso[env.Name] = "ltx-env-" + slug(env.Name)
+	}
+	for _, cmd := range l.Commands {
+		mp.seealso[cmd.Name] = "ltx-" + slug(cmd.Name)
+	}
+	return mp
+}
+
+// packageCommandPage returns the name of the man page for a package command.
+// It always contains the package name, because several packages can define
+// the same command.
+func (mp *manPages) packageCommandPage(pkg *Package, cmd *Command) string {
+	return "ltx-" + slug(pkg.Name) + "-" + slug(cmd.Name)
+}
+
+func (mp *manPages) header(buf *bytes.Buffer, page string, short map[string]string) {
+	fmt.Fprintf(buf, ".TH %s 7 \"\" \"ltxref %s\" \"LaTeX reference\"\n", strings.ToUpper(roffEscape(page)), roffEscape(mp.l.Version))
+	buf.WriteString(".SH NAME\n")
+	fmt.Fprintf(buf, "%s", roffEscape(page))
+	if s := short[mp.lang]; s != "" {
+		fmt.Fprintf(buf, ` \- %s`, roffEscape(collapseSpace(s)))
+	}
+	buf.WriteString("\n")
+}
+
+func (mp *manPages) description(buf *bytes.Buffer, desc map[string]template.HTML) {
+	if r := htmlToRoff(desc[mp.lang]); r != "" {
+		buf.WriteString(".SH DESCRIPTION\n")
+		buf.WriteString(r)
+	}
+}
+
+// history writes the version information of the entry and its variants.
+func (mp *manPages) history(buf *bytes.Buffer, h History, variants []Variant) {
+	var sb strings.Builder
+	if note := h.Note(); note != "" {
+		fmt.Fprintf(&sb, "%s\n", roffEscape(note))
+	}
+	for _, v := range variants {
+		if note := v.Note(); note != "" {
+			fmt.Fprintf(&sb, ".TP\n.B %s\n%s\n", roffEscape(v.Name), roffEscape(note))
+		}
+	}
+	if sb.Len() > 0 {
+		buf.WriteString(".SH HISTORY\n")
+		buf.WriteString(sb.String())
+	}
+}
+
+func (mp *manPages) seeAlso(buf *bytes.Buffer, pages []string) {
+	if len(pages) == 0 {
+		return
+	}
+	buf.WriteString(".SH SEE ALSO\n")
+	for i, page := range pages {
+		sep := ","
+		if i == len(pages)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(buf, ".BR %s (7)%s\n", roffEscape(page), sep)
+	}
+}
+
+// seeAlsoPages returns the man pages for the names. Commands of pkg (if not
+// nil) are preferred to commands with the same name in other packages.
+func (mp *manPages) seeAlsoPages(pkg *Package, names []string) []string {
+	var pages []string
+	for _, name := range names {
+		if pkg != nil {
+			if cmd := mp.l.GetCommandFromPackage(name, pkg.Name); cmd != nil {
+				pages = append(pages, mp.packageCommandPage(pkg, cmd))
+				continue
+			}
+		}
+		if page, ok := mp.seealso[name]; ok {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+func (mp *manPages) variants(buf *bytes.Buffer, variants []Variant, env string) {
+	buf.WriteString(".SH SYNOPSIS\n")
+	for i, v := range variants {
+		if i > 0 {
+			buf.WriteString(".br\n")
+		}
+		var sb strings.Builder
+		if env != "" {
+			fmt.Fprintf(&sb, `\fB\ebegin{%s}\fP`, roffEscape(env))
+		} else {
+			fmt.Fprintf(&sb, `\fB%s\fP`, roffEscape(v.Name))
+		}
+		for _, arg := range v.Arguments {
+			sb.WriteString(roffArgument(arg))
+		}
+		if env != "" {
+			fmt.Fprintf(&sb, ` ... \fB\eend{%s}\fP`, roffEscape(env))
+		}
+		buf.WriteString(sb.String() + "\n")
+	}
+	// variant descriptions
+	var hasdesc bool
+	for _, v := range variants {
+		if v.Description[mp.lang] != "" {
+			hasdesc = true
+		}
+	}
+	if !hasdesc {
+		return
+	}
+	buf.WriteString(".SH VARIANTS\n")
+	for _, v := range variants {
+		fmt.Fprintf(buf, ".TP\n.B %s\n", roffEscape(v.Name))
+		buf.WriteString(htmlToRoff(v.Description[mp.lang]))
+	}
+}
+
+func (mp *manPages) option(buf *bytes.Buffer, name string, dflt bool, short map[string]string, h History) {
+	buf.WriteString(".TP\n")
+	if dflt {
+		fmt.Fprintf(buf, ".BR %s \" (default)\"\n", roffEscape(name))
+	} else {
+		fmt.Fprintf(buf, ".B %s\n", roffEscape(name))
+	}
+	text := collapseSpace(short[mp.lang])
+	if note := h.Note(); note != "" {
+		text = strings.TrimSpace(text + " (" + note + ")")
+	}
+	fmt.Fprintf(buf, "%s\n", roffEscape(text))
+}
+
+func (mp *manPages) command(cmd *Command, pkg *Package, page string) []byte {
+	var buf bytes.Buffer
+	mp.header(&buf, page, cmd.ShortDescription)
+	mp.variants(&buf, cmd.Variant, "")
+	mp.description(&buf, cmd.Description)
+	mp.history(&buf, cmd.History, cmd.Variant)
+	var refs []string
+	if pkg != nil {
+		refs = append(refs, "ltx-pkg-"+slug(pkg.Name))
+	}
+	mp.seeAlso(&buf, append(refs, mp.seeAlsoPages(pkg, cmd.SeeAlso)...))
+	return buf.Bytes()
+}
+
+func (mp *manPages) environment(env *Environment, page string) []byte {
+	var buf bytes.Buffer
+	mp.header(&buf, page, env.ShortDescription)
+	mp.variants(&buf, env.Variant, env.Name)
+	mp.description(&buf, env.Description)
+	mp.history(&buf, env.History, env.Variant)
+	mp.seeAlso(&buf, mp.seeAlsoPages(nil, env.SeeAlso))
+	return buf.Bytes()
+}
+
+func (mp *manPages) class(dc *DocumentClass, page string) []byte {
+	var buf bytes.Buffer
+	mp.header(&buf, page, dc.ShortDescription)
+	fmt.Fprintf(&buf, ".SH SYNOPSIS\n\\fB\\edocumentclass\\fP[\\fIoptions\\fP]{%s}\n", roffEscape(dc.Name))
+	mp.description(&buf, dc.Description)
+	if len(dc.Optiongroup) > 0 {
+		buf.WriteString(".SH OPTIONS\n")
+		for _, og := range dc.Optiongroup {
+			if s := og.ShortDescription[mp.lang]; s != "" {
+				fmt.Fprintf(&buf, ".SS %s\n", roffEscape(collapseSpace(s)))
+			}
+			for _, co := range og.Classoption {
+				mp.option(&buf, co.Name, co.Default, co.ShortDescription, co.History)
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+func (mp *manPages) pkg(pkg *Package, page string) []byte {
+	var buf bytes.Buffer
+	mp.header(&buf, page, pkg.ShortDescription)
+	fmt.Fprintf(&buf, ".SH SYNOPSIS\n\\fB\\eusepackage\\fP[\\fIoptions\\fP]{%s}\n", roffEscape(pkg.Name))
+	mp.description(&buf, pkg.Description)
+	mp.history(&buf, pkg.History, nil)
+	if len(pkg.Options) > 0 {
+		buf.WriteString(".SH OPTIONS\n")
+		for _, po := range pkg.Options {
+			mp.option(&buf, po.Name, po.Default, po.ShortDescription, po.History)
+		}
+	}
+	var refs []string
+	for _, name := range pkg.LoadsPackages {
+		if mp.l.GetPackageWithName(name) != nil {
+			refs = append(refs, "ltx-pkg-"+slug(name))
+		}
+	}
+	for _, cmd := range pkg.Commands {
+		refs = append(refs, mp.packageCommandPage(pkg, cmd))
+	}
+	mp.seeAlso(&buf, refs)
+	return buf.Bytes()
+}
+
+// WriteManPages writes a man page (section 7) for every command,
+// environment, document class and package into the man7 subdirectory of
+// dir. The pages are named ltx-section.7 for kernel commands,
+// ltx-graphicx-includegraphics.7 for package commands, ltx-env-itemize.7 for
+// environments, ltx-class-article.7 for document classes and
+// ltx-pkg-graphicx.7 for packages. lang is the language of the descriptions.
+// Add dir to MANPATH to read the pages with man.
+func (l *Ltxref) WriteManPages(dir string, lang string) error {
+	mandir := filepath.Join(dir, "man7")
+	if err := os.MkdirAll(mandir, 0755); err != nil {
+		return err
+	}
+	mp := newManPages(l, lang)
+	write := func(page string, data []byte) error {
+		return os.WriteFile(filepath.Join(mandir, page+".7"), data, 0644)
+	}
+	for _, cmd := range l.Commands {
+		page := "ltx-" + slug(cmd.Name)
+		if err := write(page, mp.command(cmd, nil, page)); err != nil {
+			return err
+		}
+	}
+	for _, env := range l.Environments {
+		page := "ltx-env-" + slug(env.Name)
+		if err := write(page, mp.environment(env, page)); err != nil {
+			return err
+		}
+	}
+	for _, dc := range l.DocumentClasses {
+		page := "ltx-class-" + slug(dc.Name)
+		if err := write(page, mp.class(dc, page)); err != nil {
+			return err
+		}
+	}
+	for _, pkg := range l.Packages {
+		page := "ltx-pkg-" + slug(pkg.Name)
+		if err := write(page, mp.pkg(pkg, page)); err != nil {
+			return err
+		}
+		for _, cmd := range pkg.Commands {
+			page := mp.packageCommandPage(pkg, cmd)
+			if err := write(page, mp.command(cmd, pkg, page)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,595 @@
+package ltxref
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// slug returns a file name for an entry name. Lowercase letters and digits
+// are kept, a leading backslash is removed and all other characters are
+// replaced by their hex code, so \section* becomes section_2a. Uppercase
+// letters are encoded as well (\Large becomes _4carge), so that the slugs
+// are unique on case-insensitive file systems.
+func slug(name string) string {
+	name = strings.TrimPrefix(name, `\`)
+	var sb strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			sb.WriteRune(r)
+		default:
+			fmt.Fprintf(&sb, "_%x", r)
+		}
+	}
+	if sb.Len() == 0 {
+		return "_"
+	}
+	return sb.String()
+}
+
+// siteLayout knows the (extension-less, slash separated) path of every page
+// of a generated documentation site.
+type siteLayout struct {
+	l *Ltxref
+	// the page for a name in a see also list
+	seealso map[string]string
+}
+
+func newSiteLayout(l *Ltxref) *siteLayout {
+	sl := &siteLayout{l: l, seealso: make(map[string]string)}
+	for _, pkg := range l.Packages {
+		for _, cmd := range pkg.Commands {
+			sl.seealso[cmd.Name] = packageCommandPage(pkg, cmd)
+		}
+	}
+	for _, env := range l.Environments {
+		sl.seealso[env.Name] = environmentPage(env)
+	}
+	// kernel commands win over package commands with the same name
+	for _, cmd := range l.Commands {
+		sl.seealso[cmd.Name] = commandPage(cmd)
+	}
+	return sl
+}
+
+func commandPage(cmd *Command) string {
+	return "commands/" + slug(cmd.Name)
+}
+
+func packageCommandPage(pkg *Package, cmd *Command) string {
+	return "packages/" + slug(pkg.Name) + "/" + slug(cmd.Name)
+}
+
+func environmentPage(env *Environment) string {
+	return "environments/" + slug(env.Name)
+}
+
+func classPage(dc *DocumentClass) string {
+	return "classes/" + slug(dc.Name)
+}
+
+func packagePage(pkg *Package) string {
+	return "packages/" + slug(pkg.Name)
+}
+
+func tagPage(tag string) string {
+	return "tags/" + slug(tag)
+}
+
+// siteTags returns the labels without the empty label, which is read from an
+// empty label attribute and must not get a tag page.
+func siteTags(labels []string) []string {
+	var ret []string
+	for _, label := range labels {
+		if label != "" {
+			ret = append(ret, label)
+		}
+	}
+	return ret
+}
+
+// relative returns the path of target relative to the page from.
+func relative(from, target string) string {
+	depth := strings.Count(from, "/")
+	return strings.Repeat("../", depth) + target
+}
+
+// writePage writes a page of the site to dir, creating directories as needed.
+func writePage(dir string, page string, data []byte) error {
+	filename := filepath.Join(dir, filepath.FromSlash(page))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// mdEscape escapes the characters that have a meaning in Markdown text.
+func mdEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\', '*', '_', '`', '[', ']', '<', '#':
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// mdWriter converts parsed HTML to Markdown.
+type mdWriter struct {
+	buf bytes.Buffer
+	// number of newlines to write before the next text
+	pending int
+	indent  string
+}
+
+func (w *mdWriter) atLineStart() bool {
+	return w.pending > 0 || w.buf.Len() == 0 || bytes.HasSuffix(w.buf.Bytes(), []byte("\n"))
+}
+
+// breakLines requests (at least) n newlines before the next text.
+func (w *mdWriter) breakLines(n int) {
+	// remove trailing spaces of the current line
+	b := w.buf.Bytes()
+	w.buf.Truncate(len(bytes.TrimRight(b, " ")))
+	if w.buf.Len() > 0 && n > w.pending {
+		w.pending = n
+	}
+}
+
+func (w *mdWriter) write(s string) {
+	if w.pending > 0 {
+		for i := 0; i < w.pending; i++ {
+			w.buf.WriteByte('\n')
+		}
+		w.buf.WriteString(w.indent)
+		w.pending = 0
+	}
+	w.buf.WriteString(s)
+}
+
+func (w *mdWriter) children(n *htmlNode) {
+	for _, c := range n.children {
+		w.node(c)
+	}
+}
+
+func (w *mdWriter) node(n *htmlNode) {
+	switch n.name {
+	case "":
+		s := collapseSpace(n.text)
+		if w.atLineStart() {
+			s = strings.TrimLeft(s, " ")
+		}
+		if s != "" {
+			w.write(mdEscape(s))
+		}
+	case "p", "div", "blockquote", "table":
+		w.breakLines(2)
+		w.children(n)
+		w.breakLines(2)
+	case "br":
+		// hard line break (CommonMark)
+		w.write("\\")
+		w.breakLines(1)
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.breakLines(2)
+		w.write(strings.Repeat("#", int(n.name[1]-'0')+1) + " ")
+		w.children(n)
+		w.breakLines(2)
+	case "em", "i", "var":
+		w.write("*")
+		w.children(n)
+		w.write("*")
+	case "strong", "b":
+		w.write("**")
+		w.children(n)
+		w.write("**")
+	case "code", "tt", "kbd", "samp":
+		w.write("`" + n.textContent() + "`")
+	case "cmd":
+		w.write("`" + n.attr["name"] + "`")
+	case "pre":
+		w.breakLines(2)
+		w.write("```")
+		w.breakLines(1)
+		w.write(strings.Trim(n.textContent(), "\n"))
+		w.breakLines(1)
+		w.write("```")
+		w.breakLines(2)
+	case "a":
+		if href, ok := n.attr["href"]; ok {
+			w.write("[")
+			w.children(n)
+			w.write("](" + href + ")")
+		} else {
+			w.children(n)
+		}
+	case "ul", "ol":
+		w.breakLines(2)
+		for i, li := range n.children {
+			if li.name != "li" {
+				continue
+			}
+			w.breakLines(1)
+			marker := "- "
+			if n.name == "ol" {
+				marker = fmt.Sprintf("%d. ", i+1)
+			}
+			w.write(marker)
+			oldindent := w.indent
+			w.indent += strings.Repeat(" ", len(marker))
+			w.children(li)
+			w.indent = oldindent
+		}
+		w.breakLines(2)
+	case "tr":
+		w.breakLines(1)
+		w.children(n)
+	case "td", "th":
+		w.children(n)
+		w.write(" ")
+	default:
+		w.children(n)
+	}
+}
+
+// htmlToMarkdown converts a description to Markdown.
+func htmlToMarkdown(in template.HTML) string {
+	w := &mdWriter{}
+	w.children(parseHTML(in))
+	return strings.TrimSpace(w.buf.String())
+}
+
+// frontMatter writes a YAML front matter block. The values are encoded as
+// JSON, which is a subset of YAML.
+func frontMatter(buf *bytes.Buffer, keys []string, values map[string]interface{}) {
+	buf.WriteString("---\n")
+	for _, key := range keys {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		data, _ := json.Marshal(value)
+		fmt.Fprintf(buf, "%s: %s\n", key, data)
+	}
+	buf.WriteString("---\n\n")
+}
+
+var frontMatterKeys = []string{"title", "kind", "package", "level", "tags"}
+
+// markdownSite writes a reference as a set of Markdown pages.
+type markdownSite struct {
+	*siteLayout
+	lang string
+}
+
+// WriteMarkdown writes the reference as Markdown pages into dir: one page per
+// command, environment, document class and package, one page per tag and an
+// index page. Each page starts with a YAML front matter for static site
+// generators. lang is the language of the descriptions.
+func (l *Ltxref) WriteMarkdown(dir string, lang string) error {
+	ms := &markdownSite{siteLayout: newSiteLayout(l), lang: lang}
+	var err error
+	for _, cmd := range l.Commands {
+		if err = ms.writeCommand(dir, commandPage(cmd), cmd, nil); err != nil {
+			return err
+		}
+	}
+	for _, env := range l.Environments {
+		if err = ms.writeEnvironment(dir, env); err != nil {
+			return err
+		}
+	}
+	for _, dc := range l.DocumentClasses {
+		if err = ms.writeClass(dir, dc); err != nil {
+			return err
+		}
+	}
+	for _, pkg := range l.Packages {
+		if err = ms.writePackage(dir, pkg); err != nil {
+			return err
+		}
+		for _, cmd := range pkg.Commands {
+			if err = ms.writeCommand(dir, packageCommandPage(pkg, cmd), cmd, pkg); err != nil {
+				return err
+			}
+		}
+	}
+	for _, tag := range siteTags(l.Tags()) {
+		if err = ms.writeTag(dir, tag); err != nil {
+			return err
+		}
+	}
+	return ms.writeIndex(dir)
+}
+
+func (ms *markdownSite) link(from, title, target string) string {
+	return fmt.Sprintf("[%s](%s.md)", mdEscape(title), relative(from, target))
+}
+
+func (ms *markdownSite) header(buf *bytes.Buffer, page, kind, name string, pkg *Package, level Level, labels []string, short map[string]string) {
+	labels = siteTags(labels)
+	values := map[string]interface{}{
+		"title": name,
+		"kind":  kind,
+		"level": level.String(),
+		"tags":  labels,
+	}
+	if pkg != nil {
+		values["package"] = pkg.Name
+	}
+	if labels == nil {
+		values["tags"] = []string{}
+	}
+	frontMatter(buf, frontMatterKeys, values)
+	fmt.Fprintf(buf, "# %s\n\n", mdEscape(name))
+	if s := short[ms.lang]; s != "" {
+		fmt.Fprintf(buf, "%s\n\n", mdEscape(s))
+	}
+	if pkg != nil {
+		fmt.Fprintf(buf, "Package: %s\n\n", ms.link(page, pkg.Name, packagePage(pkg)))
+	}
+	if len(labels) > 0 {
+		var links []string
+		for _, label := range labels {
+			links = append(links, ms.link(page, label, tagPage(label)))
+		}
+		fmt.Fprintf(buf, "Tags: %s\n\n", strings.Join(links, ", "))
+	}
+}
+
+func (ms *markdownSite) history(buf *bytes.Buffer, h History) {
+	if note := h.Note(); note != "" {
+		fmt.Fprintf(buf, "History: %s\n\n", mdEscape(note))
+	}
+}
+
+// examples writes the examples in the language of the site and those
+// without a language.
+func (ms *markdownSite) examples(buf *bytes.Buffer, heading string, examples []*Example) {
+	examples = examplesForLang(examples, ms.lang)
+	if len(examples) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "%s Examples\n\n", heading)
+	for _, ex := range examples {
+		if ex.Title != "" {
+			fmt.Fprintf(buf, "%s\n\n", mdEscape(ex.Title))
+		}
+		fmt.Fprintf(buf, "```latex\n%s\n```\n\n", strings.Trim(ex.Source, "\n"))
+		if ex.Output != "" {
+			fmt.Fprintf(buf, "Output: %s\n\n", mdEscape(ex.Output))
+		}
+	}
+}
+
+func (ms *markdownSite) description(buf *bytes.Buffer, desc map[string]template.HTML) {
+	if md := htmlToMarkdown(desc[ms.lang]); md != "" {
+		fmt.Fprintf(buf, "%s\n\n", md)
+	}
+}
+
+func (ms *markdownSite) seeAlso(buf *bytes.Buffer, page string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	buf.WriteString("## See also\n\n")
+	for _, name := range names {
+		if target, ok := ms.seealso[name]; ok {
+			fmt.Fprintf(buf, "- %s\n", ms.link(page, name, target))
+		} else {
+			fmt.Fprintf(buf, "- %s\n", mdEscape(name))
+		}
+	}
+	buf.WriteString("\n")
+}
+
+func (ms *markdownSite) writeCommand(dir string, page string, cmd *Command, pkg *Package) error {
+	var buf bytes.Buffer
+	ms.header(&buf, page, "command", cmd.Name, pkg, cmd.Level, cmd.Label, cmd.ShortDescription)
+	ms.history(&buf, cmd.History)
+	for _, v := range cmd.Variant {
+		fmt.Fprintf(&buf, "## %s\n\n```latex\n%s\n```\n\n", mdEscape(v.Name), v.Signature())
+		ms.history(&buf, v.History)
+		ms.description(&buf, v.Description)
+		ms.examples(&buf, "###", v.Examples)
+	}
+	if md := htmlToMarkdown(cmd.Description[ms.lang]); md != "" {
+		fmt.Fprintf(&buf, "## Description\n\n%s\n\n", md)
+	}
+	ms.examples(&buf, "##", cmd.Examples)
+	ms.seeAlso(&buf, page, cmd.SeeAlso)
+	return writePage(dir, page+".md", buf.Bytes())
+}
+
+func (ms *markdownSite) writeEnvironment(dir string, env *Environment) error {
+	var buf bytes.Buffer
+	page := environmentPage(env)
+	ms.header(&buf, page, "environment", env.Name, nil, env.Level, env.Label, env.ShortDescription)
+	ms.history(&buf, env.History)
+	for _, v := range env.Variant {
+		fmt.Fprintf(&buf, "## %s\n\n```latex\n\\begin{%s}", mdEscape(v.Name), env.Name)
+		for _, arg := range v.Arguments {
+			buf.WriteString(arg.Signature())
+		}
+		fmt.Fprintf(&buf, "\n...\n\\end{%s}\n```\n\n", env.Name)
+		ms.history(&buf, v.History)
+		ms.description(&buf, v.Description)
+		ms.examples(&buf, "###", v.Examples)
+	}
+	if md := htmlToMarkdown(env.Description[ms.lang]); md != "" {
+		fmt.Fprintf(&buf, "## Description\n\n%s\n\n", md)
+	}
+	ms.examples(&buf, "##", env.Examples)
+	ms.seeAlso(&buf, page, env.SeeAlso)
+	return writePage(dir, page+".md", buf.Bytes())
+}
+
+func (ms *markdownSite) writeClass(dir string, dc *DocumentClass) error {
+	var buf bytes.Buffer
+	page := classPage(dc)
+	ms.header(&buf, page, "documentclass", dc.Name, nil, dc.Level, dc.Label, dc.ShortDescription)
+	fmt.Fprintf(&buf, "```latex\n\\documentclass{%s}\n```\n\n", dc.Name)
+	if len(dc.Optiongroup) > 0 {
+		buf.WriteString("## Class options\n\n")
+		for _, og := range dc.Optiongroup {
+			if s := og.ShortDescription[ms.lang]; s != "" {
+				fmt.Fprintf(&buf, "%s\n\n", mdEscape(s))
+			}
+			for _, co := range og.Classoption {
+				ms.option(&buf, co.Name, co.Default, co.ShortDescription, co.History)
+			}
+			buf.WriteString("\n")
+		}
+	}
+	ms.description(&buf, dc.Description)
+	return writePage(dir, page+".md", buf.Bytes())
+}
+
+func (ms *markdownSite) option(buf *bytes.Buffer, name string, dflt bool, short map[string]string, h History) {
+	fmt.Fprintf(buf, "- `%s`", name)
+	if dflt {
+		buf.WriteString(" (default)")
+	}
+	if s := short[ms.lang]; s != "" {
+		fmt.Fprintf(buf, ": %s", mdEscape(s))
+	}
+	if note := h.Note(); note != "" {
+		fmt.Fprintf(buf, " (%s)", mdEscape(note))
+	}
+	buf.WriteString("\n")
+}
+
+func (ms *markdownSite) writePackage(dir string, pkg *Package) error {
+	var buf bytes.Buffer
+	page := packagePage(pkg)
+	ms.header(&buf, page, "package", pkg.Name, nil, pkg.Level, pkg.Label, pkg.ShortDescription)
+	ms.history(&buf, pkg.History)
+	fmt.Fprintf(&buf, "```latex\n\\usepackage{%s}\n```\n\n", pkg.Name)
+	ms.description(&buf, pkg.Description)
+	ms.examples(&buf, "##", pkg.Examples)
+	if len(pkg.Options) > 0 {
+		buf.WriteString("## Package options\n\n")
+		for _, po := range pkg.Options {
+			ms.option(&buf, po.Name, po.Default, po.ShortDescription, po.History)
+		}
+		buf.WriteString("\n")
+	}
+	if len(pkg.LoadsPackages) > 0 {
+		buf.WriteString("## Loads packages\n\n")
+		for _, name := range pkg.LoadsPackages {
+			if p := ms.l.GetPackageWithName(name); p != nil {
+				fmt.Fprintf(&buf, "- %s\n", ms.link(page, name, packagePage(p)))
+			} else {
+				fmt.Fprintf(&buf, "- %s\n", mdEscape(name))
+			}
+		}
+		buf.WriteString("\n")
+	}
+	if len(pkg.Commands) > 0 {
+		buf.WriteString("## Commands\n\n")
+		for _, cmd := range pkg.Commands {
+			fmt.Fprintf(&buf, "- %s", ms.link(page, cmd.Name, packageCommandPage(pkg, cmd)))
+			if s := cmd.ShortDescription[ms.lang]; s != "" {
+				fmt.Fprintf(&buf, ": %s", mdEscape(s))
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\n")
+	}
+	return writePage(dir, page+".md", buf.Bytes())
+}
+
+// listEntry writes a list item with a link to the page and the short
+// description.
+func (ms *markdownSite) listEntry(buf *bytes.Buffer, from, name, target string, short map[string]string) {
+	fmt.Fprintf(buf, "- %s", ms.link(from, name, target))
+	if s := short[ms.lang]; s != "" {
+		fmt.Fprintf(buf, ": %s", mdEscape(s))
+	}
+	buf.WriteString("\n")
+}
+
+func (ms *markdownSite) writeTag(dir string, tag string) error {
+	var buf bytes.Buffer
+	page := tagPage(tag)
+	frontMatter(&buf, []string{"title", "kind"}, map[string]interface{}{"title": tag, "kind": "tag"})
+	fmt.Fprintf(&buf, "# %s\n\n", mdEscape(tag))
+	for _, cmd := range ms.l.Commands {
+		if hasTag(cmd.Label, tag) {
+			ms.listEntry(&buf, page, cmd.Name, commandPage(cmd), cmd.ShortDescription)
+		}
+	}
+	for _, env := range ms.l.Environments {
+		if hasTag(env.Label, tag) {
+			ms.listEntry(&buf, page, env.Name, environmentPage(env), env.ShortDescription)
+		}
+	}
+	for _, dc := range ms.l.DocumentClasses {
+		if hasTag(dc.Label, tag) {
+			ms.listEntry(&buf, page, dc.Name, classPage(dc), dc.ShortDescription)
+		}
+	}
+	for _, pkg := range ms.l.Packages {
+		if hasTag(pkg.Label, tag) {
+			ms.listEntry(&buf, page, pkg.Name, packagePage(pkg), pkg.ShortDescription)
+		}
+		for _, cmd := range pkg.Commands {
+			if hasTag(cmd.Label, tag) {
+				ms.listEntry(&buf, page, cmd.Name+" ("+pkg.Name+")", packageCommandPage(pkg, cmd), cmd.ShortDescription)
+			}
+		}
+	}
+	return writePage(dir, page+".md", buf.Bytes())
+}
+
+func (ms *markdownSite) writeIndex(dir string) error {
+	var buf bytes.Buffer
+	page := "index"
+	l := ms.l
+	frontMatter(&buf, []string{"title", "kind", "version"}, map[string]interface{}{"title": "LaTeX reference", "kind": "index", "version": l.Version})
+	buf.WriteString("# LaTeX reference\n\n")
+	if len(l.Commands) > 0 {
+		buf.WriteString("## Commands\n\n")
+		for _, cmd := range l.Commands {
+			ms.listEntry(&buf, page, cmd.Name, commandPage(cmd), cmd.ShortDescription)
+		}
+		buf.WriteString("\n")
+	}
+	if len(l.Environments) > 0 {
+		buf.WriteString("## Environments\n\n")
+		for _, env := range l.Environments {
+			ms.listEntry(&buf, page, env.Name, environmentPage(env), env.ShortDescription)
+		}
+		buf.WriteString("\n")
+	}
+	if len(l.DocumentClasses) > 0 {
+		buf.WriteString("## Document classes\n\n")
+		for _, dc := range l.DocumentClasses {
+			ms.listEntry(&buf, page, dc.Name, classPage(dc), dc.ShortDescription)
+		}
+		buf.WriteString("\n")
+	}
+	if len(l.Packages) > 0 {
+		buf.WriteString("## Packages\n\n")
+		for _, pkg := range l.Packages {
+			ms.listEntry(&buf, page, pkg.Name, packagePage(pkg), pkg.ShortDescription)
+		}
+		buf.WriteString("\n")
+	}
+	if tags := siteTags(l.Tags()); len(tags) > 0 {
+		buf.WriteString("## Tags\n\n")
+		for _, tag := range tags {
+			fmt.Fprintf(&buf, "- %s\n", ms.link(page, tag, tagPage(tag)))
+		}
+		buf.WriteString("\n")
+	}
+	return writePage(dir, page+".md", buf.Bytes())
+}
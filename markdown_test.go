@@ -0,0 +1,50 @@
+package ltxref
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// emptyLabelRef returns a reference read from XML with an unlabeled command,
+// whose empty label attribute is read as [""].
+func emptyLabelRef(t *testing.T) *Ltxref {
+	t.Helper()
+	l := &Ltxref{Version: "1"}
+	if _, err := l.AddCommand(`\section`, ""); err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := l.AddCommand(`\emph`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Label = []string{"font"}
+	var buf bytes.Buffer
+	if err = l.WriteXML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ReadXML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &r
+}
+
+func TestWriteMarkdownEmptyLabel(t *testing.T) {
+	r := emptyLabelRef(t)
+	dir := t.TempDir()
+	if err := r.WriteMarkdown(dir, "en"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "tags"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "font.md" {
+		for _, e := range entries {
+			t.Log(e.Name())
+		}
+		t.Error("want only tags/font.md")
+	}
+}
@@ -0,0 +1,218 @@
+package ltxref
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// MergePolicy decides which entry wins when both references of a Merge
+// contain an entry with the same name.
+type MergePolicy int
+
+const (
+	_ MergePolicy = iota
+	// PREFERLEFT keeps the fields of the receiver.
+	PREFERLEFT
+	// PREFERRIGHT takes the fields of the other reference.
+	PREFERRIGHT
+	// ERRORONCONFLICT returns an error if the entries differ in anything but
+	// descriptions in languages that only one of them has.
+	ERRORONCONFLICT
+)
+
+// A Source is a file that has been read into the reference.
+type Source struct {
+	Origin  string
+	Version string
+}
+
+// setOrigin records the origin (usually the file name) in every entry.
+func (l *Ltxref) setOrigin(origin string) {
+	for _, cmd := range l.Commands {
+		cmd.Origin = origin
+	}
+	for _, env := range l.Environments {
+		env.Origin = origin
+	}
+	for _, dc := range l.DocumentClasses {
+		dc.Origin = origin
+	}
+	for _, pkg := range l.Packages {
+		pkg.Origin = origin
+		for _, cmd := range pkg.Commands {
+			cmd.Origin = origin
+		}
+	}
+	l.Sources = []Source{{Origin: origin, Version: l.Version}}
+}
+
+// Merge adds the entries from other to l. Entries that exist in both are
+// combined according to the policy. The descriptions are always merged per
+// language, so a German description in other is added to an English-only
+// entry in l. The version of l is kept, the sources of other are appended to
+// the sources of l. If the policy is ERRORONCONFLICT and an entry differs, l
+// is left unchanged and an error is returned.
+func (l *Ltxref) Merge(other *Ltxref, policy MergePolicy) error {
+	if policy != PREFERLEFT && policy != PREFERRIGHT && policy != ERRORONCONFLICT {
+		return fmt.Errorf("unknown merge policy %d", policy)
+	}
+	ret := l.Clone()
+	other = other.Clone()
+	var err error
+
+	ret.Commands, err = mergeCommandLists("", ret.Commands, other.Commands, policy)
+	if err != nil {
+		return err
+	}
+	for _, env := range other.Environments {
+		i := environmentIndex(ret.Environments, env.Name)
+		if i < 0 {
+			ret.Environments = append(ret.Environments, env)
+			continue
+		}
+		left := ret.Environments[i]
+		if err = checkMergeConflict(policy, ENVIRONMENT, "", env.Name, diffEnvironment(left, env)); err != nil {
+			return err
+		}
+		winner, loser := left, env
+		if policy == PREFERRIGHT {
+			winner, loser = env, left
+		}
+		mergeShortDescriptions(winner.ShortDescription, loser.ShortDescription)
+		mergeDescriptions(winner.Description, loser.Description)
+		mergeVariantDescriptions(winner.Variant, loser.Variant)
+		ret.Environments[i] = winner
+	}
+	for _, dc := range other.DocumentClasses {
+		i := documentClassIndex(ret.DocumentClasses, dc.Name)
+		if i < 0 {
+			ret.DocumentClasses = append(ret.DocumentClasses, dc)
+			continue
+		}
+		left := ret.DocumentClasses[i]
+		if err = checkMergeConflict(policy, DOCUMENTCLASS, "", dc.Name, diffDocumentClass(left, dc)); err != nil {
+			return err
+		}
+		winner, loser := left, dc
+		if policy == PREFERRIGHT {
+			winner, loser = dc, left
+		}
+		mergeShortDescriptions(winner.ShortDescription, loser.ShortDescription)
+		mergeDescriptions(winner.Description, loser.Description)
+		ret.DocumentClasses[i] = winner
+	}
+	for _, pkg := range other.Packages {
+		i := packageIndex(ret.Packages, pkg.Name)
+		if i < 0 {
+			ret.Packages = append(ret.Packages, pkg)
+			continue
+		}
+		left := ret.Packages[i]
+		if err = checkMergeConflict(policy, PACKAGE, "", pkg.Name, diffPackage(left, pkg)); err != nil {
+			return err
+		}
+		winner, loser := left, pkg
+		if policy == PREFERRIGHT {
+			winner, loser = pkg, left
+		}
+		mergeShortDescriptions(winner.ShortDescription, loser.ShortDescription)
+		mergeDescriptions(winner.Description, loser.Description)
+		winner.Commands, err = mergeCommandLists(pkg.Name, left.Commands, pkg.Commands, policy)
+		if err != nil {
+			return err
+		}
+		ret.Packages[i] = winner
+	}
+	sort.Sort(ret.Commands)
+	sort.Sort(ret.Environments)
+	sort.Sort(ret.DocumentClasses)
+	sort.Sort(ret.Packages)
+	ret.Sources = append(ret.Sources, other.Sources...)
+	*l = *ret
+	return nil
+}
+
+func mergeCommandLists(pkgname string, left, right Commands, policy MergePolicy) (Commands, error) {
+	for _, cmd := range right {
+		i := commandIndex(left, cmd.Name)
+		if i < 0 {
+			left = append(left, cmd)
+			continue
+		}
+		if err := checkMergeConflict(policy, COMMAND, pkgname, cmd.Name, diffCommand(left[i], cmd)); err != nil {
+			return nil, err
+		}
+		winner, loser := left[i], cmd
+		if policy == PREFERRIGHT {
+			winner, loser = cmd, left[i]
+		}
+		mergeShortDescriptions(winner.ShortDescription, loser.ShortDescription)
+		mergeDescriptions(winner.Description, loser.Description)
+		mergeVariantDescriptions(winner.Variant, loser.Variant)
+		left[i] = winner
+	}
+	sort.Sort(left)
+	return left, nil
+}
+
+// checkMergeConflict returns an error for ERRORONCONFLICT if the two entries
+// differ. Descriptions that exist on one side only are no conflict.
+func checkMergeConflict(policy MergePolicy, kind EntryKind, pkgname string, name string, fields []FieldChange) error {
+	if policy != ERRORONCONFLICT {
+		return nil
+	}
+	for _, f := range fields {
+		if strings.Contains(f.Field, "description (") && (f.Old == "" || f.New == "") {
+			continue
+		}
+		if pkgname != "" {
+			name += " (package " + pkgname + ")"
+		}
+		return fmt.Errorf("merge conflict in %s %s: %s: %q vs. %q", kind, name, f.Field, f.Old, f.New)
+	}
+	return nil
+}
+
+// mergeShortDescriptions adds the languages from src that are missing in
+// dest.
+func mergeShortDescriptions(dest, src map[string]string) {
+	for lang, text := range src {
+		if _, ok := dest[lang]; !ok {
+			dest[lang] = text
+		}
+	}
+}
+
+// mergeDescriptions adds the languages from src that are missing in dest.
+func mergeDescriptions(dest, src map[string]template.HTML) {
+	for lang, text := range src {
+		if _, ok := dest[lang]; !ok {
+			dest[lang] = text
+		}
+	}
+}
+
+// mergeVariantDescriptions adds the missing languages to the variants in dest
+// and their arguments from the variants in src with the same name.
+func mergeVariantDescriptions(dest, src []Variant) {
+	for _, sv := range src {
+		for i := range dest {
+			if dest[i].Name == sv.Name {
+				if dest[i].Description == nil {
+					dest[i].Description = make(map[string]template.HTML)
+				}
+				mergeDescriptions(dest[i].Description, sv.Description)
+				if len(dest[i].Arguments) == len(sv.Arguments) {
+					for j, arg := range dest[i].Arguments {
+						if arg.Description == nil {
+							arg.Description = make(map[string]template.HTML)
+						}
+						mergeDescriptions(arg.Description, sv.Arguments[j].Description)
+					}
+				}
+			}
+		}
+	}
+}
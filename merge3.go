@@ -0,0 +1,645 @@
+package ltxref
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A Conflict is a change made differently on both sides of a three-way
+// merge. The merged reference contains our version of the field.
+type Conflict struct {
+	Kind EntryKind
+	// Package is the name of the package for package commands, empty
+	// otherwise.
+	Package string
+	Name    string
+	// Field is the path to the conflicting field. It is empty if the entry
+	// has been removed on one side and changed on the other.
+	Field  string
+	Base   string
+	Ours   string
+	Theirs string
+}
+
+func (c Conflict) String() string {
+	name := c.Kind.String() + " " + c.Name
+	if c.Package != "" {
+		name += " (package " + c.Package + ")"
+	}
+	if c.Kind == 0 {
+		name = "ltxref"
+	}
+	if c.Field == "" {
+		return fmt.Sprintf("%s: ours %s, theirs %s", name, c.Ours, c.Theirs)
+	}
+	return fmt.Sprintf("%s: %s: base %q, ours %q, theirs %q", name, c.Field, c.Base, c.Ours, c.Theirs)
+}
+
+// merger collects the conflicts of a three-way merge. kind, pkgname and name
+// describe the entry that is currently merged.
+type merger struct {
+	kind      EntryKind
+	pkgname   string
+	name      string
+	conflicts []Conflict
+}
+
+func (m *merger) conflict(field, base, ours, theirs string) {
+	m.conflicts = append(m.conflicts, Conflict{
+		Kind:    m.kind,
+		Package: m.pkgname,
+		Name:    m.name,
+		Field:   field,
+		Base:    base,
+		Ours:    ours,
+		Theirs:  theirs,
+	})
+}
+
+// pick decides a three-way merge of a single value. It returns ours and false
+// if both sides changed the value differently.
+func pick(base, ours, theirs string) (string, bool) {
+	switch {
+	case ours == theirs, theirs == base:
+		return ours, true
+	case ours == base:
+		return theirs, true
+	}
+	return ours, false
+}
+
+func (m *merger) mergeString(field, base, ours, theirs string) string {
+	ret, ok := pick(base, ours, theirs)
+	if !ok {
+		m.conflict(field, base, ours, theirs)
+	}
+	return ret
+}
+
+func (m *merger) mergeStrings(field string, base, ours, theirs []string) []string {
+	b, o, t := strings.Join(base, ","), strings.Join(ours, ","), strings.Join(theirs, ",")
+	ret, ok := pick(b, o, t)
+	if !ok {
+		m.conflict(field, b, o, t)
+	}
+	if ret == o {
+		return ours
+	}
+	return theirs
+}
+
+// mergeHistory merges each field of the version information separately.
+func (m *merger) mergeHistory(prefix string, base, ours, theirs History) History {
+	return History{
+		Since:      m.mergeString(prefix+"since", base.Since, ours.Since, theirs.Since),
+		Deprecated: m.mergeString(prefix+"deprecated", base.Deprecated, ours.Deprecated, theirs.Deprecated),
+		ReplacedBy: m.mergeString(prefix+"replacedby", base.ReplacedBy, ours.ReplacedBy, theirs.ReplacedBy),
+		Removed:    m.mergeString(prefix+"removed", base.Removed, ours.Removed, theirs.Removed),
+	}
+}
+
+// mergeExamples merges the list of examples as a whole.
+func (m *merger) mergeExamples(field string, base, ours, theirs []*Example) []*Example {
+	same := func(a, b []*Example) bool {
+		return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+	}
+	switch {
+	case same(ours, theirs), same(base, theirs):
+		return ours
+	case same(base, ours):
+		return theirs
+	}
+	count := func(examples []*Example) string {
+		return fmt.Sprintf("%d examples", len(examples))
+	}
+	m.conflict(field, count(base), count(ours), count(theirs))
+	return ours
+}
+
+func (m *merger) mergeModes(base, ours, theirs []Mode) []Mode {
+	b, o, t := formatModes(base), formatModes(ours), formatModes(theirs)
+	ret, ok := pick(b, o, t)
+	if !ok {
+		m.conflict("modes", b, o, t)
+	}
+	if ret == o {
+		return ours
+	}
+	return theirs
+}
+
+func (m *merger) mergeLevel(base, ours, theirs Level) Level {
+	ret, ok := pick(base.String(), ours.String(), theirs.String())
+	if !ok {
+		m.conflict("level", base.String(), ours.String(), theirs.String())
+	}
+	lvl, _ := ParseLevel(ret)
+	return lvl
+}
+
+// mergeShortDescription merges each language separately.
+func (m *merger) mergeShortDescription(prefix string, base, ours, theirs map[string]string) map[string]string {
+	ret := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, side := range []map[string]string{ours, theirs} {
+		for lang := range side {
+			if seen[lang] {
+				continue
+			}
+			seen[lang] = true
+			field := fmt.Sprintf("%sshortdescription (%s)", prefix, lang)
+			if text := m.mergeString(field, base[lang], ours[lang], theirs[lang]); text != "" {
+				ret[lang] = text
+			}
+		}
+	}
+	return ret
+}
+
+// mergeDescription merges each language separately.
+func (m *merger) mergeDescription(prefix string, base, ours, theirs map[string]template.HTML) map[string]template.HTML {
+	ret := make(map[string]template.HTML)
+	seen := make(map[string]bool)
+	for _, side := range []map[string]template.HTML{ours, theirs} {
+		for lang := range side {
+			if seen[lang] {
+				continue
+			}
+			seen[lang] = true
+			field := fmt.Sprintf("%sdescription (%s)", prefix, lang)
+			if text := m.mergeString(field, string(base[lang]), string(ours[lang]), string(theirs[lang])); text != "" {
+				ret[lang] = template.HTML(text)
+			}
+		}
+	}
+	return ret
+}
+
+// mergeVariants matches the variants by name. The arguments of a variant are
+// merged as a whole, the descriptions per language.
+func (m *merger) mergeVariants(base, ours, theirs []Variant) []Variant {
+	find := func(variants []Variant, name string) (Variant, bool) {
+		for _, v := range variants {
+			if v.Name == name {
+				return v, true
+			}
+		}
+		return Variant{}, false
+	}
+	var ret []Variant
+	seen := make(map[string]bool)
+	for _, side := range [][]Variant{ours, theirs} {
+		for _, v := range side {
+			if seen[v.Name] {
+				continue
+			}
+			seen[v.Name] = true
+			b, inBase := find(base, v.Name)
+			o, inOurs := find(ours, v.Name)
+			t, inTheirs := find(theirs, v.Name)
+			field := "variant " + v.Name
+			if inBase && (!inOurs || !inTheirs) {
+				// removed on one side
+				other := o
+				if !inOurs {
+					other = t
+				}
+				if len(diffVariants(nil, []Variant{b}, []Variant{other})) == 0 {
+					continue
+				}
+				m.conflict(field, b.Signature(), presence(inOurs), presence(inTheirs))
+				ret = append(ret, other)
+				continue
+			}
+			merged := NewVariant()
+			merged.Name = v.Name
+			oargs, targs := o.Arguments, t.Arguments
+			if !inOurs {
+				oargs = b.Arguments
+			}
+			if !inTheirs {
+				targs = b.Arguments
+			}
+			merged.Arguments = oargs
+			switch {
+			case sameArguments(oargs, targs), sameArguments(b.Arguments, targs):
+			case sameArguments(b.Arguments, oargs):
+				merged.Arguments = targs
+			default:
+				m.conflict(field+" / arguments", b.Signature(), o.Signature(), t.Signature())
+			}
+			merged.Description = m.mergeDescription(field+" / ", b.Description, o.Description, t.Description)
+			merged.History = m.mergeHistory(field+" / ", b.History, o.History, t.History)
+			merged.Examples = m.mergeExamples(field+" / examples", b.Examples, o.Examples, t.Examples)
+			ret = append(ret, *merged)
+		}
+	}
+	return ret
+}
+
+// sameArguments reports whether the argument lists are equal. nil and empty
+// lists are the same.
+func sameArguments(a, b []*Argument) bool {
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
+
+func presence(present bool) string {
+	if present {
+		return "changed"
+	}
+	return "removed"
+}
+
+func (m *merger) mergeCommand(base, ours, theirs *Command) *Command {
+	cmd := NewCommand()
+	cmd.Name = ours.Name
+	cmd.Level = m.mergeLevel(base.Level, ours.Level, theirs.Level)
+	cmd.Label = m.mergeStrings("label", base.Label, ours.Label, theirs.Label)
+	cmd.ShortDescription = m.mergeShortDescription("", base.ShortDescription, ours.ShortDescription, theirs.ShortDescription)
+	cmd.Description = m.mergeDescription("", base.Description, ours.Description, theirs.Description)
+	cmd.Variant = m.mergeVariants(base.Variant, ours.Variant, theirs.Variant)
+	cmd.SeeAlso = m.mergeStrings("seealso", base.SeeAlso, ours.SeeAlso, theirs.SeeAlso)
+	cmd.History = m.mergeHistory("", base.History, ours.History, theirs.History)
+	cmd.Examples = m.mergeExamples("examples", base.Examples, ours.Examples, theirs.Examples)
+	cmd.Modes = m.mergeModes(base.Modes, ours.Modes, theirs.Modes)
+	cmd.Parents = m.mergeStrings("parents", base.Parents, ours.Parents, theirs.Parents)
+	return cmd
+}
+
+func (m *merger) mergeEnvironment(base, ours, theirs *Environment) *Environment {
+	env := NewEnvironment()
+	env.Name = ours.Name
+	env.Level = m.mergeLevel(base.Level, ours.Level, theirs.Level)
+	env.Label = m.mergeStrings("label", base.Label, ours.Label, theirs.Label)
+	env.ShortDescription = m.mergeShortDescription("", base.ShortDescription, ours.ShortDescription, theirs.ShortDescription)
+	env.Description = m.mergeDescription("", base.Description, ours.Description, theirs.Description)
+	env.Variant = m.mergeVariants(base.Variant, ours.Variant, theirs.Variant)
+	env.SeeAlso = m.mergeStrings("seealso", base.SeeAlso, ours.SeeAlso, theirs.SeeAlso)
+	env.History = m.mergeHistory("", base.History, ours.History, theirs.History)
+	env.Examples = m.mergeExamples("examples", base.Examples, ours.Examples, theirs.Examples)
+	env.Modes = m.mergeModes(base.Modes, ours.Modes, theirs.Modes)
+	env.Parents = m.mergeStrings("parents", base.Parents, ours.Parents, theirs.Parents)
+	return env
+}
+
+func (m *merger) mergeDocumentClass(base, ours, theirs *DocumentClass) *DocumentClass {
+	dc := NewDocumentClass()
+	dc.Name = ours.Name
+	dc.Level = m.mergeLevel(base.Level, ours.Level, theirs.Level)
+	dc.Label = m.mergeStrings("label", base.Label, ours.Label, theirs.Label)
+	dc.ShortDescription = m.mergeShortDescription("", base.ShortDescription, ours.ShortDescription, theirs.ShortDescription)
+	dc.Description = m.mergeDescription("", base.Description, ours.Description, theirs.Description)
+	// The groups are merged as a whole, the history of the options
+	// separately.
+	b, o, t := optiongroupsWithoutHistory(base), optiongroupsWithoutHistory(ours), optiongroupsWithoutHistory(theirs)
+	groups := ours.Optiongroup
+	switch {
+	case reflect.DeepEqual(o, t), reflect.DeepEqual(b, t):
+	case reflect.DeepEqual(b, o):
+		groups = theirs.Optiongroup
+	default:
+		m.conflict("optiongroups", classOptionNames(base), classOptionNames(ours), classOptionNames(theirs))
+	}
+	history := func(dc *DocumentClass, name string) History {
+		if _, co := dc.lookupOption(name); co != nil {
+			return co.History
+		}
+		return History{}
+	}
+	for _, og := range groups {
+		og = og.Clone()
+		for _, co := range og.Classoption {
+			co.History = m.mergeHistory("option "+co.Name+" / ", history(base, co.Name), history(ours, co.Name), history(theirs, co.Name))
+		}
+		dc.Optiongroup = append(dc.Optiongroup, og)
+	}
+	return dc
+}
+
+// optiongroupsWithoutHistory returns a copy of the option groups of the
+// class without the history of the options.
+func optiongroupsWithoutHistory(dc *DocumentClass) []Optiongroup {
+	ret := make([]Optiongroup, len(dc.Optiongroup))
+	for i, og := range dc.Optiongroup {
+		ret[i] = *og
+		ret[i].Classoption = make([]*Classoption, len(og.Classoption))
+		for j, co := range og.Classoption {
+			c := *co
+			c.History = History{}
+			ret[i].Classoption[j] = &c
+		}
+	}
+	return ret
+}
+
+func classOptionNames(dc *DocumentClass) string {
+	var names []string
+	for _, og := range dc.Optiongroup {
+		for _, co := range og.Classoption {
+			names = append(names, co.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// mergePackage merges the package itself, the commands are merged separately.
+func (m *merger) mergePackage(base, ours, theirs *Package) *Package {
+	pkg := NewPackage()
+	pkg.Name = ours.Name
+	pkg.Level = m.mergeLevel(base.Level, ours.Level, theirs.Level)
+	pkg.Label = m.mergeStrings("label", base.Label, ours.Label, theirs.Label)
+	pkg.LoadsPackages = m.mergeStrings("loadspackages", base.LoadsPackages, ours.LoadsPackages, theirs.LoadsPackages)
+	pkg.ShortDescription = m.mergeShortDescription("", base.ShortDescription, ours.ShortDescription, theirs.ShortDescription)
+	pkg.Description = m.mergeDescription("", base.Description, ours.Description, theirs.Description)
+	pkg.History = m.mergeHistory("", base.History, ours.History, theirs.History)
+	pkg.Examples = m.mergeExamples("examples", base.Examples, ours.Examples, theirs.Examples)
+	// The options are merged as a whole, their history separately.
+	b, o, t := packageOptionsWithoutHistory(base), packageOptionsWithoutHistory(ours), packageOptionsWithoutHistory(theirs)
+	options := ours.Options
+	switch {
+	case reflect.DeepEqual(o, t), reflect.DeepEqual(b, t):
+	case reflect.DeepEqual(b, o):
+		options = theirs.Options
+	default:
+		m.conflict("options", packageOptionNames(base), packageOptionNames(ours), packageOptionNames(theirs))
+	}
+	history := func(pkg *Package, name string) History {
+		for _, po := range pkg.Options {
+			if po.Name == name {
+				return po.History
+			}
+		}
+		return History{}
+	}
+	for _, po := range options {
+		po = po.Clone()
+		po.History = m.mergeHistory("option "+po.Name+" / ", history(base, po.Name), history(ours, po.Name), history(theirs, po.Name))
+		pkg.Options = append(pkg.Options, po)
+	}
+	return pkg
+}
+
+// packageOptionsWithoutHistory returns a copy of the options of the package
+// without their history.
+func packageOptionsWithoutHistory(pkg *Package) []Packageoption {
+	ret := make([]Packageoption, len(pkg.Options))
+	for i, po := range pkg.Options {
+		ret[i] = *po
+		ret[i].History = History{}
+	}
+	return ret
+}
+
+func packageOptionNames(pkg *Package) string {
+	var names []string
+	for _, po := range pkg.Options {
+		names = append(names, po.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// entryState decides what to do with an entry that is missing on at least
+// one side. It returns the entry to keep (nil to drop the entry) and true, or
+// false if the entry exists on both sides and has to be merged field by
+// field.
+func (m *merger) entryState(base, ours, theirs interface{}, inBase, inOurs, inTheirs bool) (interface{}, bool) {
+	switch {
+	case inOurs && inTheirs:
+		return nil, false
+	case !inBase && inOurs:
+		return ours, true
+	case !inBase && inTheirs:
+		return theirs, true
+	case !inOurs && !inTheirs:
+		return nil, true
+	}
+	// removed on one side
+	other := ours
+	if !inOurs {
+		other = theirs
+	}
+	if sameEntry(base, other) {
+		return nil, true
+	}
+	m.conflict("", "", presence(inOurs), presence(inTheirs))
+	return other, true
+}
+
+// sameEntry reports whether a and b have the same contents. The origin of the
+// entries is not compared.
+func sameEntry(a, b interface{}) bool {
+	switch x := a.(type) {
+	case *Command:
+		return len(diffCommand(x, b.(*Command))) == 0
+	case *Environment:
+		return len(diffEnvironment(x, b.(*Environment))) == 0
+	case *DocumentClass:
+		return len(diffDocumentClass(x, b.(*DocumentClass))) == 0
+	case *Package:
+		p := b.(*Package)
+		return len(diffPackage(x, p)) == 0 && len(diffCommands("", x.Commands, p.Commands)) == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func (m *merger) mergeCommands(pkgname string, base, ours, theirs Commands) Commands {
+	var ret Commands
+	seen := make(map[string]bool)
+	for _, side := range []Commands{ours, theirs} {
+		for _, cmd := range side {
+			if seen[cmd.Name] {
+				continue
+			}
+			seen[cmd.Name] = true
+			m.kind, m.pkgname, m.name = COMMAND, pkgname, cmd.Name
+			b, o, t := NewCommand(), NewCommand(), NewCommand()
+			i, j, k := commandIndex(base, cmd.Name), commandIndex(ours, cmd.Name), commandIndex(theirs, cmd.Name)
+			if i >= 0 {
+				b = base[i]
+			}
+			if j >= 0 {
+				o = ours[j]
+			}
+			if k >= 0 {
+				t = theirs[k]
+			}
+			if keep, done := m.entryState(b, o, t, i >= 0, j >= 0, k >= 0); done {
+				if keep != nil {
+					ret = append(ret, keep.(*Command))
+				}
+				continue
+			}
+			ret = append(ret, m.mergeCommand(b, o, t))
+		}
+	}
+	return ret
+}
+
+// Merge3 merges the changes from base to ours and from base to theirs. Entries
+// are matched by kind and name, package commands also by their package.
+// Fields are merged separately, descriptions per language. Conflicting
+// changes are returned, in the merged reference our version wins. If an entry
+// is removed on one side and changed on the other, the changed entry is kept.
+func Merge3(base, ours, theirs *Ltxref) (*Ltxref, []Conflict) {
+	m := &merger{}
+	ret := &Ltxref{}
+	ret.Version = m.mergeString("version", base.Version, ours.Version, theirs.Version)
+	ret.Commands = m.mergeCommands("", base.Commands, ours.Commands, theirs.Commands)
+
+	seen := make(map[string]bool)
+	for _, side := range []Environments{ours.Environments, theirs.Environments} {
+		for _, env := range side {
+			if seen[env.Name] {
+				continue
+			}
+			seen[env.Name] = true
+			m.kind, m.pkgname, m.name = ENVIRONMENT, "", env.Name
+			b, o, t := NewEnvironment(), NewEnvironment(), NewEnvironment()
+			i, j, k := environmentIndex(base.Environments, env.Name), environmentIndex(ours.Environments, env.Name), environmentIndex(theirs.Environments, env.Name)
+			if i >= 0 {
+				b = base.Environments[i]
+			}
+			if j >= 0 {
+				o = ours.Environments[j]
+			}
+			if k >= 0 {
+				t = theirs.Environments[k]
+			}
+			if keep, done := m.entryState(b, o, t, i >= 0, j >= 0, k >= 0); done {
+				if keep != nil {
+					ret.Environments = append(ret.Environments, keep.(*Environment))
+				}
+				continue
+			}
+			ret.Environments = append(ret.Environments, m.mergeEnvironment(b, o, t))
+		}
+	}
+
+	seen = make(map[string]bool)
+	for _, side := range []DocumentClasses{ours.DocumentClasses, theirs.DocumentClasses} {
+		for _, dc := range side {
+			if seen[dc.Name] {
+				continue
+			}
+			seen[dc.Name] = true
+			m.kind, m.pkgname, m.name = DOCUMENTCLASS, "", dc.Name
+			b, o, t := NewDocumentClass(), NewDocumentClass(), NewDocumentClass()
+			i, j, k := documentClassIndex(base.DocumentClasses, dc.Name), documentClassIndex(ours.DocumentClasses, dc.Name), documentClassIndex(theirs.DocumentClasses, dc.Name)
+			if i >= 0 {
+				b = base.DocumentClasses[i]
+			}
+			if j >= 0 {
+				o = ours.DocumentClasses[j]
+			}
+			if k >= 0 {
+				t = theirs.DocumentClasses[k]
+			}
+			if keep, done := m.entryState(b, o, t, i >= 0, j >= 0, k >= 0); done {
+				if keep != nil {
+					ret.DocumentClasses = append(ret.DocumentClasses, keep.(*DocumentClass))
+				}
+				continue
+			}
+			ret.DocumentClasses = append(ret.DocumentClasses, m.mergeDocumentClass(b, o, t))
+		}
+	}
+
+	seen = make(map[string]bool)
+	for _, side := range []Packages{ours.Packages, theirs.Packages} {
+		for _, pkg := range side {
+			if seen[pkg.Name] {
+				continue
+			}
+			seen[pkg.Name] = true
+			m.kind, m.pkgname, m.name = PACKAGE, "", pkg.Name
+			b, o, t := NewPackage(), NewPackage(), NewPackage()
+			i, j, k := packageIndex(base.Packages, pkg.Name), packageIndex(ours.Packages, pkg.Name), packageIndex(theirs.Packages, pkg.Name)
+			if i >= 0 {
+				b = base.Packages[i]
+			}
+			if j >= 0 {
+				o = ours.Packages[j]
+			}
+			if k >= 0 {
+				t = theirs.Packages[k]
+			}
+			if keep, done := m.entryState(b, o, t, i >= 0, j >= 0, k >= 0); done {
+				if keep != nil {
+					ret.Packages = append(ret.Packages, keep.(*Package))
+				}
+				continue
+			}
+			merged := m.mergePackage(b, o, t)
+			merged.Commands = m.mergeCommands(pkg.Name, b.Commands, o.Commands, t.Commands)
+			sort.Sort(merged.Commands)
+			ret.Packages = append(ret.Packages, merged)
+		}
+	}
+	sort.Sort(ret.Commands)
+	sort.Sort(ret.Environments)
+	sort.Sort(ret.DocumentClasses)
+	sort.Sort(ret.Packages)
+	return ret.Clone(), m.conflicts
+}
+
+// MergeFiles does a three-way merge of the XML files and writes the result to
+// oursfile, the way git expects from a merge driver. The merged file is
+// written even if there are conflicts.
+func MergeFiles(basefile, oursfile, theirsfile string) ([]Conflict, error) {
+	var refs [3]Ltxref
+	for i, filename := range []string{basefile, oursfile, theirsfile} {
+		l, err := ReadXMLFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		refs[i] = l
+	}
+	merged, conflicts := Merge3(&refs[0], &refs[1], &refs[2])
+	w, err := os.Create(oursfile)
+	if err != nil {
+		return nil, err
+	}
+	if err = merged.WriteXML(w); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return conflicts, w.Close()
+}
+
+// GitMergeDriver is the entry point for a git merge driver. args are the
+// base, ours and theirs file names (%O %A %B). The conflicts are reported on
+// stderr. The return value is the exit code for git: 0 for a clean merge, 1
+// if there are conflicts and 2 on errors. A small main program is enough:
+//
+//	func main() {
+//		os.Exit(ltxref.GitMergeDriver(os.Args[1:]))
+//	}
+//
+// and in .git/config and .gitattributes:
+//
+//	[merge "ltxref"]
+//		driver = ltxref-merge %O %A %B
+//
+//	ltxref*.xml merge=ltxref
+func GitMergeDriver(args []string) int {
+	if len(args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: ltxref-merge base ours theirs")
+		return 2
+	}
+	conflicts, err := MergeFiles(args[0], args[1], args[2])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	for _, c := range conflicts {
+		fmt.Fprintln(os.Stderr, "conflict:", c)
+	}
+	if len(conflicts) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,255 @@
+package ltxref
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mergeTestRef returns a small reference with a kernel command, an
+// environment and a package with a command.
+func mergeTestRef(t *testing.T) *Ltxref {
+	t.Helper()
+	l := &Ltxref{Version: "1"}
+	cmd, err := l.AddCommand(`\section`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.ShortDescription["en"] = "Start a section"
+	v := NewVariant()
+	v.Name = `\section`
+	cmd.Variant = []Variant{*v}
+	if _, err = l.AddEnvironment("itemize"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.AddPackage("graphicx"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.AddCommand(`\includegraphics`, "graphicx"); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestMerge3(t *testing.T) {
+	section := func(l *Ltxref) *Command { return l.GetCommandFromPackage(`\section`, "") }
+	tests := []struct {
+		name      string
+		ours      func(l *Ltxref)
+		theirs    func(l *Ltxref)
+		conflicts int
+		check     func(l *Ltxref) bool
+	}{
+		{
+			name:   "ours changed",
+			ours:   func(l *Ltxref) { section(l).ShortDescription["en"] = "ours" },
+			theirs: func(l *Ltxref) {},
+			check:  func(l *Ltxref) bool { return section(l).ShortDescription["en"] == "ours" },
+		},
+		{
+			name:   "theirs changed",
+			ours:   func(l *Ltxref) {},
+			theirs: func(l *Ltxref) { section(l).Level = EXPERT },
+			check:  func(l *Ltxref) bool { return section(l).Level == EXPERT },
+		},
+		{
+			name:   "both changed identically",
+			ours:   func(l *Ltxref) { section(l).Since = "2e" },
+			theirs: func(l *Ltxref) { section(l).Since = "2e" },
+			check:  func(l *Ltxref) bool { return section(l).Since == "2e" },
+		},
+		{
+			name:   "different fields",
+			ours:   func(l *Ltxref) { section(l).Label = []string{"structure"} },
+			theirs: func(l *Ltxref) { section(l).Description["en"] = "<p>x</p>" },
+			check: func(l *Ltxref) bool {
+				return hasTag(section(l).Label, "structure") && section(l).Description["en"] == "<p>x</p>"
+			},
+		},
+		{
+			name:      "conflict",
+			ours:      func(l *Ltxref) { section(l).ShortDescription["en"] = "ours" },
+			theirs:    func(l *Ltxref) { section(l).ShortDescription["en"] = "theirs" },
+			conflicts: 1,
+			check:     func(l *Ltxref) bool { return section(l).ShortDescription["en"] == "ours" },
+		},
+		{
+			name:   "added",
+			ours:   func(l *Ltxref) { l.AddCommand(`\chapter`, "") },
+			theirs: func(l *Ltxref) { l.AddCommand(`\rotatebox`, "graphicx") },
+			check: func(l *Ltxref) bool {
+				return l.GetCommandFromPackage(`\chapter`, "") != nil && l.GetCommandFromPackage(`\rotatebox`, "graphicx") != nil
+			},
+		},
+		{
+			name:   "removed",
+			ours:   func(l *Ltxref) { l.RemoveEnvironment("itemize") },
+			theirs: func(l *Ltxref) { l.RemoveCommand(`\includegraphics`, "graphicx") },
+			check: func(l *Ltxref) bool {
+				return l.GetEnvironmentWithName("itemize") == nil && l.GetCommandFromPackage(`\includegraphics`, "graphicx") == nil
+			},
+		},
+		{
+			name:      "removed and changed",
+			ours:      func(l *Ltxref) { l.RemoveCommand(`\section`, "") },
+			theirs:    func(l *Ltxref) { section(l).Level = EXPERT },
+			conflicts: 1,
+			check:     func(l *Ltxref) bool { return section(l) != nil && section(l).Level == EXPERT },
+		},
+	}
+	for _, tt := range tests {
+		base := mergeTestRef(t)
+		ours, theirs := base.Clone(), base.Clone()
+		tt.ours(ours)
+		tt.theirs(theirs)
+		merged, conflicts := Merge3(base, ours, theirs)
+		if len(conflicts) != tt.conflicts {
+			t.Errorf("%s: got conflicts %v, want %d", tt.name, conflicts, tt.conflicts)
+		}
+		if !tt.check(merged) {
+			t.Errorf("%s: wrong merge result", tt.name)
+		}
+		if d := Diff(base, mergeTestRef(t)); len(d.Changes) != 0 {
+			t.Errorf("%s: base has been changed: %v", tt.name, d.Changes)
+		}
+	}
+}
+
+// fillValue sets v to a non-zero value.
+func fillValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int:
+		v.SetInt(1)
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), 1, 1)
+		fillValue(s.Index(0))
+		v.Set(s)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		val := reflect.New(v.Type().Elem()).Elem()
+		fillValue(val)
+		m.SetMapIndex(reflect.ValueOf("en").Convert(v.Type().Key()), val)
+		v.Set(m)
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		fillValue(p.Elem())
+		v.Set(p)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fillValue(v.Field(i))
+			}
+		}
+	}
+}
+
+// TestMerge3AllFields changes one field at a time on one side and makes
+// sure that the change survives the merge, so that new fields cannot be
+// forgotten in the merge.
+func TestMerge3AllFields(t *testing.T) {
+	skip := map[string]bool{"Name": true, "Origin": true}
+	type entry struct {
+		kind string
+		get  func(l *Ltxref) reflect.Value
+	}
+	entries := []entry{
+		{"command", func(l *Ltxref) reflect.Value {
+			return reflect.ValueOf(l.GetCommandFromPackage(`\section`, "")).Elem()
+		}},
+		{"variant", func(l *Ltxref) reflect.Value {
+			return reflect.ValueOf(&l.GetCommandFromPackage(`\section`, "").Variant[0]).Elem()
+		}},
+		{"environment", func(l *Ltxref) reflect.Value {
+			return reflect.ValueOf(l.GetEnvironmentWithName("itemize")).Elem()
+		}},
+		{"package", func(l *Ltxref) reflect.Value {
+			return reflect.ValueOf(l.GetPackageWithName("graphicx")).Elem()
+		}},
+		{"package command", func(l *Ltxref) reflect.Value {
+			return reflect.ValueOf(l.GetCommandFromPackage(`\includegraphics`, "graphicx")).Elem()
+		}},
+	}
+	for _, e := range entries {
+		typ := e.get(mergeTestRef(t)).Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i).Name
+			if skip[field] {
+				continue
+			}
+			for _, side := range []string{"ours", "theirs"} {
+				base := mergeTestRef(t)
+				ours, theirs := base.Clone(), base.Clone()
+				changed := theirs
+				if side == "ours" {
+					changed = ours
+				}
+				fillValue(e.get(changed).Field(i))
+				merged, conflicts := Merge3(base, ours, theirs)
+				if len(conflicts) != 0 {
+					t.Errorf("%s %s changed by %s: conflicts %v", e.kind, field, side, conflicts)
+					continue
+				}
+				got, want := e.get(merged).Field(i).Interface(), e.get(changed).Field(i).Interface()
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s %s changed by %s: got %#v, want %#v", e.kind, field, side, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestGitMergeDriver(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, l *Ltxref) string {
+		t.Helper()
+		filename := filepath.Join(dir, name)
+		f, err := os.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = l.WriteXML(f); err != nil {
+			t.Fatal(err)
+		}
+		if err = f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	base := mergeTestRef(t)
+	ours, theirs := base.Clone(), base.Clone()
+	ours.GetCommandFromPackage(`\section`, "").Level = EXPERT
+	theirs.GetCommandFromPackage(`\section`, "").ShortDescription["en"] = "theirs"
+	args := []string{write("base.xml", base), write("ours.xml", ours), write("theirs.xml", theirs)}
+	if code := GitMergeDriver(args); code != 0 {
+		t.Errorf("clean merge: exit code %d", code)
+	}
+	merged, err := ReadXMLFile(args[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd := merged.GetCommandFromPackage(`\section`, ""); cmd.Level != EXPERT || cmd.ShortDescription["en"] != "theirs" {
+		t.Errorf("clean merge: got %v %q", cmd.Level, cmd.ShortDescription["en"])
+	}
+
+	ours.GetCommandFromPackage(`\section`, "").ShortDescription["en"] = "ours"
+	args[1] = write("ours.xml", ours)
+	if code := GitMergeDriver(args); code != 1 {
+		t.Errorf("conflict: exit code %d", code)
+	}
+
+	if code := GitMergeDriver(args[:2]); code != 2 {
+		t.Errorf("two arguments: exit code %d", code)
+	}
+	if code := GitMergeDriver([]string{filepath.Join(dir, "missing.xml"), args[1], args[2]}); code != 2 {
+		t.Errorf("missing file: exit code %d", code)
+	}
+	if data, err := os.ReadFile(args[1]); err != nil || !strings.Contains(string(data), "ours") {
+		t.Errorf("ours file: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package ltxref
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// An EffectiveOption is an option in effect for a \documentclass line.
+type EffectiveOption struct {
+	Name  string
+	Value string
+	// Implied is true for default options that are not given explicitly.
+	Implied bool
+	// The class option, nil for global options that the class does not know
+	// (they are passed to the packages).
+	Option *Classoption
+	// The group of the option, nil for global options
+	Group *Optiongroup
+}
+
+// validate makes sure that an exclusive group has exactly one default
+// option.
+func (og *Optiongroup) validate() error {
+	if !og.Exclusive {
+		return nil
+	}
+	var defaults []string
+	for _, co := range og.Classoption {
+		if co.Default {
+			defaults = append(defaults, co.Name)
+		}
+	}
+	if len(defaults) != 1 {
+		return fmt.Errorf("exclusive option group %s needs exactly one default, has %d (%s)", og.name(), len(defaults), strings.Join(defaults, ", "))
+	}
+	return nil
+}
+
+// name returns the English short description or the names of the options.
+func (og *Optiongroup) name() string {
+	if name := og.ShortDescription["en"]; name != "" {
+		return name
+	}
+	var names []string
+	for _, co := range og.Classoption {
+		names = append(names, co.Name)
+	}
+	return strings.Join(names, "|")
+}
+
+// ResolveOptions returns the options in effect for
+// \documentclass[options]{class}: the given options in their order followed
+// by the implied defaults, group by group. Options the class does not know
+// are returned as global options. Two options of an exclusive group and
+// invalid option values are errors.
+func (l *Ltxref) ResolveOptions(class string, options []string) ([]EffectiveOption, error) {
+	dc := l.GetDocumentClass(class)
+	if dc == nil {
+		return nil, fmt.Errorf("documentclass %s: %w", class, ErrNotFound)
+	}
+	var ret []EffectiveOption
+	var problems []string
+	given := make(map[*Optiongroup]string)
+	set := make(map[*Classoption]bool)
+	for _, item := range options {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		name, value, hasValue := splitKeyval(item)
+		og, co := dc.lookupOption(name)
+		if co == nil {
+			ret = append(ret, EffectiveOption{Name: name, Value: value})
+			continue
+		}
+		if msg := co.checkValue(value, hasValue); msg != "" {
+			problems = append(problems, fmt.Sprintf("option %s: %s", name, msg))
+		}
+		if !hasValue {
+			value = co.DefaultValue
+		}
+		if og.Exclusive {
+			if other, ok := given[og]; ok && other != name {
+				problems = append(problems, fmt.Sprintf("options %s and %s conflict (%s)", other, name, og.name()))
+				continue
+			}
+			given[og] = name
+		}
+		if set[co] {
+			// the last value wins
+			for i := range ret {
+				if ret[i].Option == co {
+					ret[i].Value = value
+				}
+			}
+			continue
+		}
+		set[co] = true
+		ret = append(ret, EffectiveOption{Name: name, Value: value, Option: co, Group: og})
+	}
+	for _, og := range dc.Optiongroup {
+		if _, ok := given[og]; ok {
+			continue
+		}
+		for _, co := range og.Classoption {
+			if co.Default && !set[co] {
+				ret = append(ret, EffectiveOption{Name: co.Name, Value: co.DefaultValue, Implied: true, Option: co, Group: og})
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return ret, errors.New(strings.Join(problems, "; "))
+	}
+	return ret, nil
+}
+
+// lookupOption returns the option with the name and its group.
+func (dc *DocumentClass) lookupOption(name string) (*Optiongroup, *Classoption) {
+	for _, og := range dc.Optiongroup {
+		for _, co := range og.Classoption {
+			if co.Name == name {
+				return og, co
+			}
+		}
+	}
+	return nil, nil
+}
+
+// WriteEffectiveOptions resolves the options of \documentclass[options]{class}
+// and writes the effective configuration per option group. Problems with the
+// options are shown in the output and returned after it has been written.
+func (l *Ltxref) WriteEffectiveOptions(w io.Writer, class string, options []string) error {
+	dc := l.GetDocumentClass(class)
+	effective, err := l.ResolveOptions(class, options)
+	if err != nil && dc == nil {
+		return err
+	}
+	type group struct {
+		Name    string
+		Options []EffectiveOption
+	}
+	var groups []group
+	for _, og := range dc.Optiongroup {
+		g := group{Name: og.name()}
+		for _, eo := range effective {
+			if eo.Group == og {
+				g.Options = append(g.Options, eo)
+			}
+		}
+		groups = append(groups, g)
+	}
+	var global []EffectiveOption
+	for _, eo := range effective {
+		if eo.Option == nil {
+			global = append(global, eo)
+		}
+	}
+	data := struct {
+		Class   *DocumentClass
+		Line    string
+		Groups  []group
+		Global  []EffectiveOption
+		Problem string
+	}{
+		Class:  dc,
+		Line:   `\documentclass[` + strings.Join(options, ",") + "]{" + class + "}",
+		Groups: groups,
+		Global: global,
+	}
+	if err != nil {
+		data.Problem = err.Error()
+	}
+	if tplerr := tpl.ExecuteTemplate(w, "effectiveoptions", data); tplerr != nil {
+		return tplerr
+	}
+	return err
+}
@@ -1,27 +1,65 @@
 package ltxref
 
 import (
+	"errors"
+	"fmt"
 	"sort"
 	"strings"
 
 	"github.com/renstrom/fuzzysearch/fuzzy"
 )
 
+var (
+	// ErrNotFound is returned when an entry or a package does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrExists is returned when an entry with the new name already exists.
+	ErrExists = errors.New("already exists")
+	// ErrInvalidName is returned when the name of a new entry is empty or
+	// not valid for its kind.
+	ErrInvalidName = errors.New("invalid name")
+)
+
+// AddCommand adds a new command to the package pkg or to the kernel commands
+// if pkg is empty. The package must exist.
 func (l *Ltxref) AddCommand(commandname string, pkg string) (*Command, error) {
+	if err := checkCommandName(commandname); err != nil {
+		return nil, err
+	}
+	cmds, err := l.commandList(pkg)
+	if err != nil {
+		return nil, err
+	}
+	if commandIndex(*cmds, commandname) >= 0 {
+		return nil, fmt.Errorf("command %s: %w", commandname, ErrExists)
+	}
 	cmd := NewCommand()
 	cmd.Name = commandname
-	if pkg == "" {
-		l.Commands = append(l.Commands, cmd)
-		sort.Sort(l.Commands)
-	} else {
-		p := l.GetPackageWithName(pkg)
-		p.Commands = append(p.Commands, cmd)
-		sort.Sort(p.Commands)
-	}
+	*cmds = append(*cmds, cmd)
+	sort.Sort(*cmds)
 	return cmd, nil
 }
 
+// AddCommandCreatePackage is like AddCommand but creates the package pkg if
+// it does not exist yet.
+func (l *Ltxref) AddCommandCreatePackage(commandname string, pkg string) (*Command, error) {
+	if err := checkCommandName(commandname); err != nil {
+		return nil, err
+	}
+	if pkg != "" && l.GetPackageWithName(pkg) == nil {
+		if _, err := l.AddPackage(pkg); err != nil {
+			return nil, err
+		}
+	}
+	return l.AddCommand(commandname, pkg)
+}
+
 func (l *Ltxref) AddDocumentClass(dcname string) (*DocumentClass, error) {
+	if err := checkName("documentclass", dcname); err != nil {
+		return nil, err
+	}
+	if documentClassIndex(l.DocumentClasses, dcname) >= 0 {
+		return nil, fmt.Errorf("documentclass %s: %w", dcname, ErrExists)
+	}
 	dc := NewDocumentClass()
 	dc.Name = dcname
 	l.DocumentClasses = append(l.DocumentClasses, dc)
@@ -30,6 +68,12 @@ func (l *Ltxref) AddDocumentClass(dcname string) (*DocumentClass, error) {
 }
 
 func (l *Ltxref) AddEnvironment(envname string) (*Environment, error) {
+	if err := checkEnvironmentName(envname); err != nil {
+		return nil, err
+	}
+	if environmentIndex(l.Environments, envname) >= 0 {
+		return nil, fmt.Errorf("environment %s: %w", envname, ErrExists)
+	}
 	env := NewEnvironment()
 	env.Name = envname
 	l.Environments = append(l.Environments, env)
@@ -38,6 +82,12 @@ func (l *Ltxref) AddEnvironment(envname string) (*Environment, error) {
 }
 
 func (l *Ltxref) AddPackage(pkgname string) (*Package, error) {
+	if err := checkName("package", pkgname); err != nil {
+		return nil, err
+	}
+	if packageIndex(l.Packages, pkgname) >= 0 {
+		return nil, fmt.Errorf("package %s: %w", pkgname, ErrExists)
+	}
 	pkg := NewPackage()
 	pkg.Name = pkgname
 	l.Packages = append(l.Packages, pkg)
@@ -45,6 +95,276 @@ func (l *Ltxref) AddPackage(pkgname string) (*Package, error) {
 	return pkg, nil
 }
 
+// checkName makes sure that the name of a package or a document class is not
+// empty and can be stored in comma separated lists.
+func checkName(kind string, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s: empty name: %w", kind, ErrInvalidName)
+	}
+	if strings.ContainsAny(name, ", \t\n{}\\") {
+		return fmt.Errorf("%s %q: %w", kind, name, ErrInvalidName)
+	}
+	return nil
+}
+
+// Command names start with a backslash, such as \section.
+func checkCommandName(name string) error {
+	if name == "" {
+		return fmt.Errorf("command: empty name: %w", ErrInvalidName)
+	}
+	if len(name) < 2 || name[0] != '\\' || strings.ContainsAny(name, " \t\n{}") {
+		return fmt.Errorf("command %q: %w", name, ErrInvalidName)
+	}
+	return nil
+}
+
+// Environment names are used in \begin{...}, such as itemize.
+func checkEnvironmentName(name string) error {
+	if name == "" {
+		return fmt.Errorf("environment: empty name: %w", ErrInvalidName)
+	}
+	if strings.ContainsAny(name, "\\{} \t\n") {
+		return fmt.Errorf("environment %q: %w", name, ErrInvalidName)
+	}
+	return nil
+}
+
+// commandList returns a pointer to the list of commands of the package pkg or
+// the kernel commands if pkg is empty.
+func (l *Ltxref) commandList(pkg string) (*Commands, error) {
+	if pkg == "" {
+		return &l.Commands, nil
+	}
+	p := l.GetPackageWithName(pkg)
+	if p == nil {
+		return nil, fmt.Errorf("package %s: %w", pkg, ErrNotFound)
+	}
+	return &p.Commands, nil
+}
+
+func commandIndex(cmds Commands, name string) int {
+	for i, cmd := range cmds {
+		if cmd.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func environmentIndex(envs Environments, name string) int {
+	for i, env := range envs {
+		if env.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func documentClassIndex(classes DocumentClasses, name string) int {
+	for i, dc := range classes {
+		if dc.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func packageIndex(pkgs Packages, name string) int {
+	for i, pkg := range pkgs {
+		if pkg.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// RemoveCommand removes the command from the package pkg. If pkg is empty,
+// the command is removed from the kernel commands.
+func (l *Ltxref) RemoveCommand(commandname string, pkg string) error {
+	cmds, err := l.commandList(pkg)
+	if err != nil {
+		return err
+	}
+	i := commandIndex(*cmds, commandname)
+	if i < 0 {
+		return fmt.Errorf("command %s: %w", commandname, ErrNotFound)
+	}
+	*cmds = append((*cmds)[:i], (*cmds)[i+1:]...)
+	return nil
+}
+
+func (l *Ltxref) RemoveDocumentClass(dcname string) error {
+	i := documentClassIndex(l.DocumentClasses, dcname)
+	if i < 0 {
+		return fmt.Errorf("documentclass %s: %w", dcname, ErrNotFound)
+	}
+	l.DocumentClasses = append(l.DocumentClasses[:i], l.DocumentClasses[i+1:]...)
+	return nil
+}
+
+func (l *Ltxref) RemoveEnvironment(envname string) error {
+	i := environmentIndex(l.Environments, envname)
+	if i < 0 {
+		return fmt.Errorf("environment %s: %w", envname, ErrNotFound)
+	}
+	l.Environments = append(l.Environments[:i], l.Environments[i+1:]...)
+	return nil
+}
+
+// RemovePackage removes the package and all of its commands. References in
+// the LoadsPackages lists of other packages are left untouched.
+func (l *Ltxref) RemovePackage(pkgname string) error {
+	i := packageIndex(l.Packages, pkgname)
+	if i < 0 {
+		return fmt.Errorf("package %s: %w", pkgname, ErrNotFound)
+	}
+	l.Packages = append(l.Packages[:i], l.Packages[i+1:]...)
+	return nil
+}
+
+// RenameCommand renames a command in the package pkg (or in the kernel
+// commands if pkg is empty) and updates all see also references.
+func (l *Ltxref) RenameCommand(oldname string, newname string, pkg string) error {
+	cmds, err := l.commandList(pkg)
+	if err != nil {
+		return err
+	}
+	i := commandIndex(*cmds, oldname)
+	if i < 0 {
+		return fmt.Errorf("command %s: %w", oldname, ErrNotFound)
+	}
+	if oldname == newname {
+		return nil
+	}
+	if err := checkCommandName(newname); err != nil {
+		return err
+	}
+	if commandIndex(*cmds, newname) >= 0 {
+		return fmt.Errorf("command %s: %w", newname, ErrExists)
+	}
+	(*cmds)[i].Name = newname
+	sort.Sort(*cmds)
+	l.renameSeeAlso(oldname, newname)
+	return nil
+}
+
+func (l *Ltxref) RenameDocumentClass(oldname string, newname string) error {
+	i := documentClassIndex(l.DocumentClasses, oldname)
+	if i < 0 {
+		return fmt.Errorf("documentclass %s: %w", oldname, ErrNotFound)
+	}
+	if oldname == newname {
+		return nil
+	}
+	if err := checkName("documentclass", newname); err != nil {
+		return err
+	}
+	if documentClassIndex(l.DocumentClasses, newname) >= 0 {
+		return fmt.Errorf("documentclass %s: %w", newname, ErrExists)
+	}
+	l.DocumentClasses[i].Name = newname
+	sort.Sort(l.DocumentClasses)
+	return nil
+}
+
+// RenameEnvironment renames an environment and updates all see also
+// references.
+func (l *Ltxref) RenameEnvironment(oldname string, newname string) error {
+	i := environmentIndex(l.Environments, oldname)
+	if i < 0 {
+		return fmt.Errorf("environment %s: %w", oldname, ErrNotFound)
+	}
+	if oldname == newname {
+		return nil
+	}
+	if err := checkEnvironmentName(newname); err != nil {
+		return err
+	}
+	if environmentIndex(l.Environments, newname) >= 0 {
+		return fmt.Errorf("environment %s: %w", newname, ErrExists)
+	}
+	l.Environments[i].Name = newname
+	sort.Sort(l.Environments)
+	l.renameSeeAlso(oldname, newname)
+	return nil
+}
+
+// RenamePackage renames a package and updates the LoadsPackages lists of all
+// packages.
+func (l *Ltxref) RenamePackage(oldname string, newname string) error {
+	i := packageIndex(l.Packages, oldname)
+	if i < 0 {
+		return fmt.Errorf("package %s: %w", oldname, ErrNotFound)
+	}
+	if oldname == newname {
+		return nil
+	}
+	if err := checkName("package", newname); err != nil {
+		return err
+	}
+	if packageIndex(l.Packages, newname) >= 0 {
+		return fmt.Errorf("package %s: %w", newname, ErrExists)
+	}
+	l.Packages[i].Name = newname
+	sort.Sort(l.Packages)
+	for _, pkg := range l.Packages {
+		replaceName(pkg.LoadsPackages, oldname, newname)
+	}
+	return nil
+}
+
+// MoveCommand moves a command from one package to another. An empty package
+// name denotes the kernel commands.
+func (l *Ltxref) MoveCommand(commandname string, from string, to string) error {
+	src, err := l.commandList(from)
+	if err != nil {
+		return err
+	}
+	dest, err := l.commandList(to)
+	if err != nil {
+		return err
+	}
+	i := commandIndex(*src, commandname)
+	if i < 0 {
+		return fmt.Errorf("command %s: %w", commandname, ErrNotFound)
+	}
+	if from == to {
+		return nil
+	}
+	if commandIndex(*dest, commandname) >= 0 {
+		return fmt.Errorf("command %s: %w", commandname, ErrExists)
+	}
+	cmd := (*src)[i]
+	*src = append((*src)[:i], (*src)[i+1:]...)
+	*dest = append(*dest, cmd)
+	sort.Sort(*dest)
+	return nil
+}
+
+// renameSeeAlso replaces oldname by newname in the see also lists of all
+// commands and environments.
+func (l *Ltxref) renameSeeAlso(oldname string, newname string) {
+	for _, cmd := range l.Commands {
+		replaceName(cmd.SeeAlso, oldname, newname)
+	}
+	for _, env := range l.Environments {
+		replaceName(env.SeeAlso, oldname, newname)
+	}
+	for _, pkg := range l.Packages {
+		for _, cmd := range pkg.Commands {
+			replaceName(cmd.SeeAlso, oldname, newname)
+		}
+	}
+}
+
+func replaceName(names []string, oldname string, newname string) {
+	for i, name := range names {
+		if name == oldname {
+			names[i] = newname
+		}
+	}
+}
+
 // packagename may be empty for the kernel commands
 func (l *Ltxref) GetCommandFromPackage(commandname string, packagename string) *Command {
 	var cmdlist []*Command
@@ -137,15 +457,26 @@ func (l *Ltxref) Tags() []string {
 	return mk
 }
 
-// Case insensitive fuzzy match.
-func (l *Ltxref) FilterCommands(like string, tag string, showexpert bool) Commands {
+// Case insensitive fuzzy match. Only commands up to (and including) maxlevel
+// are returned.
+func (l *Ltxref) FilterCommands(like string, tag string, maxlevel Level) Commands {
+	return filterCommands(l.Commands, like, tag, maxlevel)
+}
+
+// Case insensitive fuzzy match on the commands defined in the package. Only
+// commands up to (and including) maxlevel are returned.
+func (p *Package) FilterCommands(like string, tag string, maxlevel Level) Commands {
+	return filterCommands(p.Commands, like, tag, maxlevel)
+}
+
+func filterCommands(commands Commands, like string, tag string, maxlevel Level) Commands {
 	var commandsThatMatch Commands
 	like = strings.ToLower(like)
 	tag = strings.ToLower(tag)
 
-	for _, command := range l.Commands {
+	for _, command := range commands {
 		if (like == "" || fuzzy.Match(like, command.Name)) && (tag == "" || hasTag(command.Label, tag)) {
-			if !showexpert && command.Level != "expert" || showexpert {
+			if command.Level <= maxlevel {
 				commandsThatMatch = append(commandsThatMatch, command)
 			}
 
@@ -154,9 +485,10 @@ func (l *Ltxref) FilterCommands(like string, tag string, showexpert bool) Comman
 	return commandsThatMatch
 }
 
-// Case insensitive fuzzy match.
-func (l *Ltxref) FilterEnvironments(like string, tag string, showexpert bool) Environments {
-	if like == "" && tag == "" && showexpert {
+// Case insensitive fuzzy match. Only environments up to (and including)
+// maxlevel are returned.
+func (l *Ltxref) FilterEnvironments(like string, tag string, maxlevel Level) Environments {
+	if like == "" && tag == "" && maxlevel >= INTERNAL {
 		return l.Environments
 	} else {
 		like = strings.ToLower(like)
@@ -165,7 +497,7 @@ func (l *Ltxref) FilterEnvironments(like string, tag string, showexpert bool) En
 	var itemsThatMatch Environments
 	for _, item := range l.Environments {
 		if fuzzy.Match(like, item.Name) && (tag == "" || hasTag(item.Label, tag)) {
-			if !showexpert && item.Level != "expert" || showexpert {
+			if item.Level <= maxlevel {
 				itemsThatMatch = append(itemsThatMatch, item)
 			}
 		}
@@ -173,9 +505,10 @@ func (l *Ltxref) FilterEnvironments(like string, tag string, showexpert bool) En
 	return itemsThatMatch
 }
 
-// Case insensitive fuzzy match.
-func (l *Ltxref) FilterDocumentClasses(like string, tag string, showexpert bool) DocumentClasses {
-	if like == "" && tag == "" && showexpert {
+// Case insensitive fuzzy match. Only document classes up to (and including)
+// maxlevel are returned.
+func (l *Ltxref) FilterDocumentClasses(like string, tag string, maxlevel Level) DocumentClasses {
+	if like == "" && tag == "" && maxlevel >= INTERNAL {
 		return l.DocumentClasses
 	} else {
 		like = strings.ToLower(like)
@@ -184,7 +517,7 @@ func (l *Ltxref) FilterDocumentClasses(like string, tag string, showexpert bool)
 	var itemsThatMatch DocumentClasses
 	for _, item := range l.DocumentClasses {
 		if fuzzy.Match(like, item.Name) && (tag == "" || hasTag(item.Label, tag)) {
-			if !showexpert && item.Level != "expert" || showexpert {
+			if item.Level <= maxlevel {
 				itemsThatMatch = append(itemsThatMatch, item)
 			}
 		}
@@ -192,31 +525,67 @@ func (l *Ltxref) FilterDocumentClasses(like string, tag string, showexpert bool)
 	return itemsThatMatch
 }
 
-// Case insensitive fuzzy match.
-func (l *Ltxref) FilterPackages(like string, tag string) []*Package {
-	if like == "" && tag == "" {
+// Case insensitive fuzzy match. A package matches if its name and tag match
+// or if one of its commands up to maxlevel matches. Packages above maxlevel
+// are never returned. Use Package.FilterCommands with the same arguments to
+// get the matching commands of a package.
+func (l *Ltxref) FilterPackages(like string, tag string, maxlevel Level) Packages {
+	if like == "" && tag == "" && maxlevel >= INTERNAL {
 		return l.Packages
 	} else {
 		like = strings.ToLower(like)
 		tag = strings.ToLower(tag)
 	}
-	var itemsThatMatch []*Package
+	var itemsThatMatch Packages
 	for _, item := range l.Packages {
+		if item.Level > maxlevel {
+			continue
+		}
 		if fuzzy.Match(like, item.Name) && (tag == "" || hasTag(item.Label, tag)) {
 			itemsThatMatch = append(itemsThatMatch, item)
-		} else {
-			for _, command := range item.Commands {
-				if (like == "" || fuzzy.Match(like, command.Name)) && (tag == "" || hasTag(command.Label, tag)) {
-					itemsThatMatch = append(itemsThatMatch, item)
-					break
-				}
-			}
-
+		} else if len(filterCommands(item.Commands, like, tag, maxlevel)) > 0 {
+			itemsThatMatch = append(itemsThatMatch, item)
 		}
 	}
 	return itemsThatMatch
 }
 
+// WithoutDeprecated returns the commands that are neither deprecated nor
+// removed, for example l.FilterCommands("sec", "", EXPERT).WithoutDeprecated().
+func (slice Commands) WithoutDeprecated() Commands {
+	var ret Commands
+	for _, cmd := range slice {
+		if !cmd.IsDeprecated() {
+			ret = append(ret, cmd)
+		}
+	}
+	return ret
+}
+
+// WithoutDeprecated returns the environments that are neither deprecated
+// nor removed.
+func (slice Environments) WithoutDeprecated() Environments {
+	var ret Environments
+	for _, env := range slice {
+		if !env.IsDeprecated() {
+			ret = append(ret, env)
+		}
+	}
+	return ret
+}
+
+// WithoutDeprecated returns the packages that are neither deprecated nor
+// removed. The commands of the packages are not filtered.
+func (slice Packages) WithoutDeprecated() Packages {
+	var ret Packages
+	for _, pkg := range slice {
+		if !pkg.IsDeprecated() {
+			ret = append(ret, pkg)
+		}
+	}
+	return ret
+}
+
 // Return true if command c has the given label (tag)
 func hasTag(labels []string, label string) bool {
 	for _, v := range labels {
@@ -226,3 +595,64 @@ func hasTag(labels []string, label string) bool {
 	}
 	return false
 }
+
+// Validate checks that all entries have valid names and that no name is used
+// twice for the same kind of entry. Package commands are checked per package.
+func (l *Ltxref) Validate() error {
+	if err := validateCommands(l.Commands); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, env := range l.Environments {
+		if err := checkEnvironmentName(env.Name); err != nil {
+			return err
+		}
+		if seen[env.Name] {
+			return fmt.Errorf("environment %s: %w", env.Name, ErrExists)
+		}
+		seen[env.Name] = true
+	}
+	seen = make(map[string]bool)
+	for _, dc := range l.DocumentClasses {
+		if err := checkName("documentclass", dc.Name); err != nil {
+			return err
+		}
+		if seen[dc.Name] {
+			return fmt.Errorf("documentclass %s: %w", dc.Name, ErrExists)
+		}
+		seen[dc.Name] = true
+		for _, og := range dc.Optiongroup {
+			if err := og.validate(); err != nil {
+				return fmt.Errorf("documentclass %s: %w", dc.Name, err)
+			}
+		}
+	}
+	seen = make(map[string]bool)
+	for _, pkg := range l.Packages {
+		if err := checkName("package", pkg.Name); err != nil {
+			return err
+		}
+		if seen[pkg.Name] {
+			return fmt.Errorf("package %s: %w", pkg.Name, ErrExists)
+		}
+		seen[pkg.Name] = true
+		if err := validateCommands(pkg.Commands); err != nil {
+			return fmt.Errorf("package %s: %w", pkg.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateCommands(cmds Commands) error {
+	seen := make(map[string]bool)
+	for _, cmd := range cmds {
+		if err := checkCommandName(cmd.Name); err != nil {
+			return err
+		}
+		if seen[cmd.Name] {
+			return fmt.Errorf("command %s: %w", cmd.Name, ErrExists)
+		}
+		seen[cmd.Name] = true
+	}
+	return nil
+}
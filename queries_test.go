@@ -0,0 +1,113 @@
+package ltxref
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckName(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"graphicx", nil},
+		{"scrartcl", nil},
+		{"tikz-cd", nil},
+		{"", ErrInvalidName},
+		{"a,b", ErrInvalidName},
+		{"a b", ErrInvalidName},
+		{"a\tb", ErrInvalidName},
+		{"a\nb", ErrInvalidName},
+		{"{a}", ErrInvalidName},
+		{`\a`, ErrInvalidName},
+	}
+	for _, tt := range tests {
+		if err := checkName("package", tt.name); !errors.Is(err, tt.err) {
+			t.Errorf("checkName(%q) = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestCheckCommandName(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{`\section`, nil},
+		{`\\`, nil},
+		{`\@startsection`, nil},
+		{"", ErrInvalidName},
+		{`\`, ErrInvalidName},
+		{"section", ErrInvalidName},
+		{`\a b`, ErrInvalidName},
+		{`\a{}`, ErrInvalidName},
+		{"\\a\n", ErrInvalidName},
+	}
+	for _, tt := range tests {
+		if err := checkCommandName(tt.name); !errors.Is(err, tt.err) {
+			t.Errorf("checkCommandName(%q) = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestAddCommand(t *testing.T) {
+	l := &Ltxref{}
+	if _, err := l.AddPackage("graphicx"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cmd string
+		pkg string
+		err error
+	}{
+		{`\section`, "", nil},
+		{`\section`, "", ErrExists},
+		{`\includegraphics`, "graphicx", nil},
+		{`\includegraphics`, "graphicx", ErrExists},
+		{`\includegraphics`, "", nil},
+		{`\section`, "graphicx", nil},
+		{`\foo`, "nosuchpackage", ErrNotFound},
+		{"section", "", ErrInvalidName},
+		{"", "graphicx", ErrInvalidName},
+	}
+	for _, tt := range tests {
+		cmd, err := l.AddCommand(tt.cmd, tt.pkg)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("AddCommand(%q, %q) = %v, want %v", tt.cmd, tt.pkg, err, tt.err)
+			continue
+		}
+		if err == nil && (cmd == nil || cmd.Name != tt.cmd) {
+			t.Errorf("AddCommand(%q, %q) returned %v", tt.cmd, tt.pkg, cmd)
+		}
+	}
+	if got := l.GetCommandFromPackage(`\includegraphics`, "graphicx"); got == nil {
+		t.Error(`\includegraphics not found in graphicx`)
+	}
+	if len(l.Commands) != 2 {
+		t.Errorf("got %d kernel commands, want 2", len(l.Commands))
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	l := &Ltxref{}
+	if _, err := l.AddCommand(`\section`, ""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		what string
+		err  error
+	}{
+		{"RemoveCommand", l.RemoveCommand(`\chapter`, "")},
+		{"RemoveCommand package", l.RemoveCommand(`\section`, "graphicx")},
+		{"RemoveEnvironment", l.RemoveEnvironment("itemize")},
+		{"RemoveDocumentClass", l.RemoveDocumentClass("article")},
+		{"RemovePackage", l.RemovePackage("graphicx")},
+		{"RenameCommand", l.RenameCommand(`\chapter`, `\part`, "")},
+		{"RenameDocumentClass", l.RenameDocumentClass("article", "book")},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, ErrNotFound) {
+			t.Errorf("%s = %v, want %v", tt.what, tt.err, ErrNotFound)
+		}
+	}
+}
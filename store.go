@@ -0,0 +1,103 @@
+package ltxref
+
+import (
+	"sync"
+)
+
+// StoreEvent is sent to the subscribers of a Store after each change.
+type StoreEvent struct {
+	Old *Ltxref
+	New *Ltxref
+}
+
+// A Store holds a reference that can be read and changed from several
+// goroutines. Changes are made on a copy of the current reference which
+// replaces the current one when the change is complete (copy-on-write), so a
+// snapshot never changes once it is returned.
+type Store struct {
+	mu      sync.RWMutex // protects current and subscribers
+	writemu sync.Mutex   // serializes updates
+	current *Ltxref
+
+	subscribers map[chan StoreEvent]bool
+}
+
+// NewStore returns a store with l as the current reference. The store takes
+// ownership of l, the caller must not change it afterwards.
+func NewStore(l *Ltxref) *Store {
+	if l == nil {
+		l = &Ltxref{}
+	}
+	return &Store{
+		current:     l,
+		subscribers: make(map[chan StoreEvent]bool),
+	}
+}
+
+// Snapshot returns the current reference. The returned value must be treated
+// as read only.
+func (s *Store) Snapshot() *Ltxref {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Update calls fn with a copy of the current reference. If fn returns nil, the
+// copy becomes the current reference and the subscribers are notified. If fn
+// returns an error, all changes are discarded and the error is returned.
+// Updates are atomic: other goroutines see either all changes made by fn or
+// none of them.
+func (s *Store) Update(fn func(l *Ltxref) error) error {
+	s.writemu.Lock()
+	defer s.writemu.Unlock()
+
+	old := s.Snapshot()
+	l := old.Clone()
+	if err := fn(l); err != nil {
+		return err
+	}
+	s.swap(old, l)
+	return nil
+}
+
+// Replace sets l as the current reference. The store takes ownership of l.
+func (s *Store) Replace(l *Ltxref) {
+	s.writemu.Lock()
+	defer s.writemu.Unlock()
+	s.swap(s.Snapshot(), l)
+}
+
+func (s *Store) swap(old, l *Ltxref) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = l
+	event := StoreEvent{Old: old, New: l}
+	for ch := range s.subscribers {
+		// Don't let a slow subscriber block the writers.
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives an event after each change.
+// Events are dropped if the channel buffer (of size buffer) is full. The
+// returned function cancels the subscription and closes the channel.
+func (s *Store) Subscribe(buffer int) (<-chan StoreEvent, func()) {
+	ch := make(chan StoreEvent, buffer)
+	s.mu.Lock()
+	s.subscribers[ch] = true
+	s.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subscribers, ch)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
@@ -0,0 +1,101 @@
+package ltxref
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestStoreConcurrent is meant to be run with go test -race.
+func TestStoreConcurrent(t *testing.T) {
+	const writers, updates = 4, 50
+	s := NewStore(nil)
+	ch, cancel := s.Subscribe(writers * updates)
+	var writerswg, wg sync.WaitGroup
+
+	for i := 0; i < writers; i++ {
+		writerswg.Add(1)
+		go func(i int) {
+			defer writerswg.Done()
+			for j := 0; j < updates; j++ {
+				err := s.Update(func(l *Ltxref) error {
+					_, err := l.AddCommand(fmt.Sprintf(`\cmd%dx%d`, i, j), "")
+					return err
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				l := s.Snapshot()
+				n := len(l.Commands)
+				for _, cmd := range l.Commands {
+					_ = cmd.Name
+				}
+				if len(l.Commands) != n {
+					t.Error("snapshot changed")
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				sub, unsubscribe := s.Subscribe(1)
+				select {
+				case ev := <-sub:
+					if ev.New == nil || ev.Old == nil {
+						t.Error("incomplete event")
+					}
+				default:
+				}
+				unsubscribe()
+				unsubscribe()
+			}
+		}()
+	}
+
+	var eventswg sync.WaitGroup
+	eventswg.Add(1)
+	events := 0
+	go func() {
+		defer eventswg.Done()
+		for ev := range ch {
+			if len(ev.New.Commands) != len(ev.Old.Commands)+1 {
+				t.Errorf("event from %d to %d commands", len(ev.Old.Commands), len(ev.New.Commands))
+			}
+			events++
+		}
+	}()
+
+	writerswg.Wait()
+	close(done)
+	wg.Wait()
+	cancel()
+	eventswg.Wait()
+
+	if got := len(s.Snapshot().Commands); got != writers*updates {
+		t.Errorf("got %d commands, want %d", got, writers*updates)
+	}
+	if events != writers*updates {
+		t.Errorf("got %d events, want %d", events, writers*updates)
+	}
+}
@@ -0,0 +1,31 @@
+// Client side search over the pre-built index in search-index.js.
+(function () {
+  var input = document.getElementById("search");
+  var results = document.getElementById("searchresults");
+  if (!input || !results || typeof ltxrefSearchIndex === "undefined") {
+    return;
+  }
+  var root = input.getAttribute("data-root");
+  input.addEventListener("input", function () {
+    var q = input.value.toLowerCase();
+    results.innerHTML = "";
+    if (q === "") {
+      return;
+    }
+    var count = 0;
+    for (var i = 0; i < ltxrefSearchIndex.length && count < 20; i++) {
+      var e = ltxrefSearchIndex[i];
+      if (e.name.toLowerCase().indexOf(q) < 0 && e.short.toLowerCase().indexOf(q) < 0) {
+        continue;
+      }
+      var li = document.createElement("li");
+      var a = document.createElement("a");
+      a.href = root + e.url + ".html";
+      a.textContent = e.name;
+      li.appendChild(a);
+      li.appendChild(document.createTextNode(" " + e.kind + (e.package ? " (" + e.package + ")" : "") + " " + e.short));
+      results.appendChild(li);
+      count++;
+    }
+  });
+})();
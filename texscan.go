@@ -0,0 +1,116 @@
+package ltxref
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// texScanner reads LaTeX code. pos is the current byte offset into src.
+type texScanner struct {
+	src string
+	pos int
+}
+
+// readLaTeXCode returns the source without comments. The line structure is
+// kept so that offsets can be turned into line numbers. If the source is a
+// documented source (.dtx), everything outside of the macrocode environments
+// is dropped.
+func readLaTeXCode(r io.Reader) (string, error) {
+	var lines []string
+	dtx := false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, `%    \begin{macrocode}`) {
+			dtx = true
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	inCode := !dtx
+	for i, line := range lines {
+		if dtx {
+			switch {
+			case strings.HasPrefix(line, `%    \begin{macrocode}`):
+				inCode = true
+				lines[i] = ""
+				continue
+			case strings.HasPrefix(line, `%    \end{macrocode}`):
+				inCode = false
+			}
+		}
+		if !inCode {
+			lines[i] = ""
+			continue
+		}
+		lines[i] = stripComment(line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// stripComment removes everything from the first unescaped % on.
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '%':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func (s *texScanner) lineno(pos int) int {
+	return strings.Count(s.src[:pos], "\n") + 1
+}
+
+// controlSequence reads the control sequence at the current position.
+func (s *texScanner) controlSequence() string {
+	cs := cwlCommandName(s.src[s.pos:])
+	cs = strings.TrimSuffix(cs, "*")
+	s.pos += len(cs)
+	return cs
+}
+
+func (s *texScanner) skipSpace() {
+	for s.pos < len(s.src) && strings.IndexByte(" \t\n", s.src[s.pos]) >= 0 {
+		s.pos++
+	}
+}
+
+// group reads a balanced group delimited by open and closing and returns
+// its contents. ok is false if there is no such group at the current
+// position.
+func (s *texScanner) group(open, closing byte) (string, bool, error) {
+	s.skipSpace()
+	if s.pos >= len(s.src) || s.src[s.pos] != open {
+		return "", false, nil
+	}
+	start := s.pos
+	depth := 0
+	for i := s.pos; i < len(s.src); i++ {
+		switch s.src[i] {
+		case '\\':
+			i++
+			continue
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+		if depth == 0 && s.src[i] == closing && (closing != '}' || i > start) {
+			s.pos = i + 1
+			return s.src[start+1 : i], true, nil
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	return "", false, fmt.Errorf("unbalanced %c", open)
+}
@@ -5,6 +5,7 @@ import (
 	ht "html/template"
 	"io"
 	"strings"
+	"text/tabwriter"
 	"text/template"
 	"unicode/utf8"
 
@@ -27,9 +28,9 @@ func tfunderline(cmd string, level int) string {
 	}
 	return cmd + "\n" + strings.Repeat(char, len(cmd)) + "\n"
 }
-func tfshowargument(in Argumenttype) string {
+func tfshowargument(a *Argument) string {
 	var ret string
-	switch in {
+	switch a.Type {
 	case OPTARG:
 		ret = "[...]"
 	case OPTLIST:
@@ -42,12 +43,83 @@ func tfshowargument(in Argumenttype) string {
 		ret = "to ‹dimen› [or] spread ‹dimen›"
 	case KEYVALLIST:
 		ret = "[..=..,..=..,..=..]"
+	case STAR:
+		ret = "*"
+	case TOKEN:
+		ret = a.Delimiters
+	case DELIMITED:
+		open, closing := splitDelimiters(a.Delimiters)
+		ret = open + "..." + closing
+	case VERBATIM:
+		ret = "|...|"
+	case EMBELLISHMENT:
+		ret = a.Delimiters + "{...}"
+	case BODY:
+		ret = "‹body›"
 	default:
 		ret = "??"
 	}
+	// short enough for the optional placeholder "(n)"
+	for utf8.RuneCountInString(ret) < 3 {
+		ret = " " + ret + " "
+	}
 	return ret
 }
 
+// splitDelimiters returns the opening and the closing delimiter of a
+// DELIMITED argument.
+func splitDelimiters(delimiters string) (string, string) {
+	r := []rune(delimiters)
+	if len(r) != 2 {
+		return delimiters, delimiters
+	}
+	return string(r[0]), string(r[1])
+}
+
+// Signature returns the argument as it is written in the source, such as
+// "[toc]" or "{title}".
+func (a *Argument) Signature() string {
+	switch a.Type {
+	case OPTARG:
+		return "[" + a.Name + "]"
+	case OPTLIST:
+		return "[" + a.Name + ",...]"
+	case MANDARG:
+		return "{" + a.Name + "}"
+	case MANDLIST:
+		return "{" + a.Name + ",...}"
+	case TODIMENORSPREADDIMEN:
+		return " to ‹" + a.Name + "›"
+	case KEYVALLIST:
+		return "[" + a.Name + "=...]"
+	case STAR:
+		return "*"
+	case TOKEN:
+		return a.Delimiters
+	case DELIMITED:
+		open, closing := splitDelimiters(a.Delimiters)
+		return open + a.Name + closing
+	case VERBATIM:
+		return "|" + a.Name + "|"
+	case EMBELLISHMENT:
+		return a.Delimiters + "{" + a.Name + "}"
+	case BODY:
+		return ""
+	}
+	return a.Name
+}
+
+// Signature returns the variant with all arguments, such as
+// "\section[toc]{title}".
+func (v Variant) Signature() string {
+	var sb strings.Builder
+	sb.WriteString(v.Name)
+	for _, arg := range v.Arguments {
+		sb.WriteString(arg.Signature())
+	}
+	return sb.String()
+}
+
 func tfspace(cmd string) string {
 	l := utf8.RuneCountInString(cmd)
 	return strings.Repeat(" ", l)
@@ -58,11 +130,11 @@ func tfenvspace(cmd string) string {
 	return strings.Repeat(" ", l)
 }
 
-func tfplaceholder(in Argumenttype, count int, optional bool) string {
-	l := utf8.RuneCountInString(tfshowargument(in))
+func tfplaceholder(a *Argument, count int) string {
+	l := utf8.RuneCountInString(tfshowargument(a))
 	count += 1
 	var num string
-	if optional {
+	if a.Optional {
 		num = fmt.Sprintf("(%d)", count)
 	} else {
 		num = fmt.Sprintf("%d", count)
@@ -81,6 +153,69 @@ func tfplaceholder(in Argumenttype, count int, optional bool) string {
 	return r
 }
 
+// tflegend returns a line that explains the argument with the number count
+// (zero based) or an empty string if there is neither a description nor a
+// default value.
+func tflegend(a *Argument, count int) string {
+	desc := strings.TrimSpace(tfshowdescription(a.Description["en"]))
+	if desc == "" && a.Default == "" {
+		return ""
+	}
+	num := fmt.Sprintf(" %d ", count+1)
+	if a.Optional {
+		num = fmt.Sprintf("(%d)", count+1)
+	}
+	line := num + " " + a.Name
+	if desc != "" {
+		line += ": " + strings.Join(strings.Fields(desc), " ")
+	}
+	if a.Default != "" {
+		line += " (default: " + a.Default + ")"
+	}
+	return line + "\n"
+}
+
+// tfkeytable returns a table of the keys of a key value argument or an
+// empty string if the argument has no keys.
+func tfkeytable(a *Argument) string {
+	if len(a.Keys) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\nKeys for %s:\n", a.Name)
+	tw := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  Key\tType\tDefault\tDescription")
+	for _, k := range a.Keys {
+		typ := k.Type.String()
+		if k.Type == CHOICEVALUE {
+			typ += " (" + strings.Join(k.Choices, "|") + ")"
+		}
+		desc := strings.Join(strings.Fields(tfshowdescription(k.Description["en"])), " ")
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", k.Name, typ, k.Default, desc)
+	}
+	tw.Flush()
+	return sb.String()
+}
+
+// tfoptionvalue returns the value part of an option such as "=‹dimension›"
+// or "=a4paper|letterpaper".
+func tfoptionvalue(ov OptionValue) string {
+	var ret string
+	switch ov.Kind {
+	case KEYVALOPTION:
+		ret = "=‹" + ov.Type.String() + "›"
+		if len(ov.Values) > 0 {
+			ret = "=" + strings.Join(ov.Values, "|")
+		}
+	case CHOICEOPTION:
+		ret = "=" + strings.Join(ov.Values, "|")
+	}
+	if ov.DefaultValue != "" {
+		ret += " (default value " + ov.DefaultValue + ")"
+	}
+	return ret
+}
+
 func tfshowdescription(in ht.HTML) string {
 	str, err := html2text.FromString(string(in), "", 0)
 	if err != nil {
@@ -89,6 +224,17 @@ func tfshowdescription(in ht.HTML) string {
 	return str
 }
 
+// tfindent indents each line of the source by four spaces.
+func tfindent(src string) string {
+	lines := strings.Split(strings.Trim(src, "\n"), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = "    " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 func init() {
 	funcMap := map[string]interface{}{
 		"underline":       tfunderline,
@@ -96,7 +242,12 @@ func init() {
 		"space":           tfspace,
 		"envspace":        tfenvspace,
 		"placehoder":      tfplaceholder,
+		"legend":          tflegend,
+		"keytable":        tfkeytable,
+		"optionvalue":     tfoptionvalue,
 		"showdescription": tfshowdescription,
+		"indent":          tfindent,
+		"modes":           formatModes,
 	}
 
 	maintemplate := string(MustAsset("templates/main.txt"))
@@ -1,6 +1,7 @@
 package ltxref
 
 import (
+	"fmt"
 	"html/template"
 	"strings"
 )
@@ -15,6 +16,14 @@ const (
 	OPTLIST
 	TODIMENORSPREADDIMEN
 	KEYVALLIST
+	// The argument types of xparse (\NewDocumentCommand). The characters of
+	// TOKEN, DELIMITED and EMBELLISHMENT are stored in Argument.Delimiters.
+	STAR
+	TOKEN
+	DELIMITED
+	VERBATIM
+	EMBELLISHMENT
+	BODY
 )
 
 var argumenttypemap map[string]Argumenttype
@@ -28,6 +37,12 @@ func init() {
 		"optlist":              OPTLIST,
 		"todimenorspreaddimen": TODIMENORSPREADDIMEN,
 		"keyvallist":           KEYVALLIST,
+		"star":                 STAR,
+		"token":                TOKEN,
+		"delimited":            DELIMITED,
+		"verbatim":             VERBATIM,
+		"embellishment":        EMBELLISHMENT,
+		"body":                 BODY,
 	}
 	argumentTypeReveseMap = make(map[Argumenttype]string, len(argumenttypemap))
 	for key, value := range argumenttypemap {
@@ -35,6 +50,259 @@ func init() {
 	}
 }
 
+// Level is the audience an entry is written for. The levels are ordered, so
+// a filter for EXPERT also includes the BEGINNER and INTERMEDIATE entries.
+// The zero value is BEGINNER.
+type Level int
+
+const (
+	BEGINNER Level = iota
+	INTERMEDIATE
+	EXPERT
+	INTERNAL
+)
+
+var levelmap = map[string]Level{
+	"beginner":     BEGINNER,
+	"intermediate": INTERMEDIATE,
+	"expert":       EXPERT,
+	"internal":     INTERNAL,
+}
+
+var levelReverseMap map[Level]string
+
+func init() {
+	levelReverseMap = make(map[Level]string, len(levelmap))
+	for key, value := range levelmap {
+		levelReverseMap[value] = key
+	}
+}
+
+// ParseLevel returns the level for the name used in the XML file. An empty
+// string is the default level (BEGINNER).
+func ParseLevel(name string) (Level, error) {
+	if name == "" {
+		return BEGINNER, nil
+	}
+	if lvl, ok := levelmap[name]; ok {
+		return lvl, nil
+	}
+	return BEGINNER, fmt.Errorf("unknown level %q", name)
+}
+
+func (l Level) String() string {
+	if name, ok := levelReverseMap[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Optionkind tells if a class or package option is a plain flag (draft), a
+// key with a value (margin=2cm) or a key with a value from a list
+// (paper=a4paper). The zero value is FLAGOPTION.
+type Optionkind int
+
+const (
+	FLAGOPTION Optionkind = iota
+	KEYVALOPTION
+	CHOICEOPTION
+)
+
+var optionkindmap = map[string]Optionkind{
+	"flag":   FLAGOPTION,
+	"keyval": KEYVALOPTION,
+	"choice": CHOICEOPTION,
+}
+
+var optionkindReverseMap map[Optionkind]string
+
+func init() {
+	optionkindReverseMap = make(map[Optionkind]string, len(optionkindmap))
+	for key, value := range optionkindmap {
+		optionkindReverseMap[value] = key
+	}
+}
+
+// ParseOptionkind returns the option kind for the name used in the XML file.
+// An empty string is FLAGOPTION.
+func ParseOptionkind(name string) (Optionkind, error) {
+	if name == "" {
+		return FLAGOPTION, nil
+	}
+	if ok, found := optionkindmap[name]; found {
+		return ok, nil
+	}
+	return FLAGOPTION, fmt.Errorf("unknown option kind %q", name)
+}
+
+func (ok Optionkind) String() string {
+	if name, found := optionkindReverseMap[ok]; found {
+		return name
+	}
+	return fmt.Sprintf("optionkind(%d)", int(ok))
+}
+
+// Mode is a LaTeX mode in which a command or an environment can be used.
+// TEXTMODE is inside a paragraph, VERTICALMODE between paragraphs and
+// PREAMBLEMODE before \begin{document}.
+type Mode int
+
+const (
+	TEXTMODE Mode = iota
+	MATHMODE
+	PREAMBLEMODE
+	VERTICALMODE
+)
+
+var modemap = map[string]Mode{
+	"text":     TEXTMODE,
+	"math":     MATHMODE,
+	"preamble": PREAMBLEMODE,
+	"vertical": VERTICALMODE,
+}
+
+var modeReverseMap map[Mode]string
+
+func init() {
+	modeReverseMap = make(map[Mode]string, len(modemap))
+	for key, value := range modemap {
+		modeReverseMap[value] = key
+	}
+}
+
+// ParseMode returns the mode for the name used in the XML file.
+func ParseMode(name string) (Mode, error) {
+	if m, found := modemap[name]; found {
+		return m, nil
+	}
+	return TEXTMODE, fmt.Errorf("unknown mode %q", name)
+}
+
+func (m Mode) String() string {
+	if name, found := modeReverseMap[m]; found {
+		return name
+	}
+	return fmt.Sprintf("mode(%d)", int(m))
+}
+
+// formatModes returns the comma separated names of the modes.
+func formatModes(modes []Mode) string {
+	names := make([]string, len(modes))
+	for i, m := range modes {
+		names[i] = m.String()
+	}
+	return strings.Join(names, ",")
+}
+
+// OptionValue describes the value of a class or package option.
+type OptionValue struct {
+	Kind Optionkind
+	// The type of the value of a KEYVALOPTION
+	Type Valuetype
+	// The allowed values of a CHOICEOPTION
+	Values []string
+	// The value used if the option is given without a value
+	DefaultValue string
+}
+
+// History records when an entry has been introduced, deprecated or removed.
+// The versions are free text such as "2020-10-01" or "1.2". Empty fields
+// are unknown or not applicable.
+type History struct {
+	Since      string
+	Deprecated string
+	// Name of the command, environment, package or option to use instead of
+	// a deprecated entry
+	ReplacedBy string
+	Removed    string
+}
+
+// IsDeprecated returns true if the entry is deprecated or removed.
+func (h History) IsDeprecated() bool {
+	return h.Deprecated != "" || h.Removed != ""
+}
+
+// Note returns a short English summary of the history such as
+// "since 2020-10-01, deprecated in 2.0, use \bfseries instead" or the empty
+// string.
+func (h History) Note() string {
+	var parts []string
+	if h.Since != "" {
+		parts = append(parts, "since "+h.Since)
+	}
+	if h.Deprecated != "" {
+		parts = append(parts, "deprecated in "+h.Deprecated)
+	}
+	if h.Removed != "" {
+		parts = append(parts, "removed in "+h.Removed)
+	}
+	if h.ReplacedBy != "" {
+		parts = append(parts, "use "+h.ReplacedBy+" instead")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// An Example is a LaTeX snippet that shows how to use a command, an
+// environment or a package.
+type Example struct {
+	Title string
+	// The language of the title and the output description, such as "en"
+	Lang string
+	// The LaTeX source, usually the body of a document. A source with
+	// \documentclass is a complete document.
+	Source string
+	// Optional description of the expected output
+	Output string
+}
+
+// Valuetype is the type of the value of a key in a key value list. The zero
+// value is TEXTVALUE (any text).
+type Valuetype int
+
+const (
+	TEXTVALUE Valuetype = iota
+	DIMENSIONVALUE
+	INTEGERVALUE
+	BOOLEANVALUE
+	CHOICEVALUE
+)
+
+var valuetypemap = map[string]Valuetype{
+	"text":      TEXTVALUE,
+	"dimension": DIMENSIONVALUE,
+	"integer":   INTEGERVALUE,
+	"boolean":   BOOLEANVALUE,
+	"choice":    CHOICEVALUE,
+}
+
+var valuetypeReverseMap map[Valuetype]string
+
+func init() {
+	valuetypeReverseMap = make(map[Valuetype]string, len(valuetypemap))
+	for key, value := range valuetypemap {
+		valuetypeReverseMap[value] = key
+	}
+}
+
+// ParseValuetype returns the value type for the name used in the XML file.
+// An empty string is TEXTVALUE.
+func ParseValuetype(name string) (Valuetype, error) {
+	if name == "" {
+		return TEXTVALUE, nil
+	}
+	if vt, ok := valuetypemap[name]; ok {
+		return vt, nil
+	}
+	return TEXTVALUE, fmt.Errorf("unknown value type %q", name)
+}
+
+func (vt Valuetype) String() string {
+	if name, ok := valuetypeReverseMap[vt]; ok {
+		return name
+	}
+	return fmt.Sprintf("valuetype(%d)", int(vt))
+}
+
 type DocumentClasses []*DocumentClass
 
 func (slice DocumentClasses) Len() int {
@@ -70,15 +338,19 @@ type Ltxref struct {
 	DocumentClasses DocumentClasses
 	Packages        Packages
 	Version         string
+	// The files this reference has been read from, see Merge
+	Sources []Source
 }
 
 type DocumentClass struct {
 	Name             string
 	Label            []string
-	Level            string
+	Level            Level
 	ShortDescription map[string]string
 	Description      map[string]template.HTML
 	Optiongroup      []*Optiongroup
+	// The file the entry has been read from (not written to XML)
+	Origin string
 }
 
 func NewDocumentClass() *DocumentClass {
@@ -94,9 +366,13 @@ func NewOptionGroup() *Optiongroup {
 	return og
 }
 
+// Optiongroup is a group of class options. In an exclusive group (10pt,
+// 11pt, 12pt) only one option can be given and exactly one option is the
+// default. The options of other groups are independent of each other.
 type Optiongroup struct {
 	ShortDescription map[string]string
 	Classoption      []*Classoption
+	Exclusive        bool
 }
 
 func NewClassOption() *Classoption {
@@ -109,6 +385,8 @@ type Classoption struct {
 	Name             string
 	Default          bool
 	ShortDescription map[string]string
+	OptionValue
+	History
 }
 
 func NewCommand() *Command {
@@ -120,11 +398,22 @@ func NewCommand() *Command {
 
 type Command struct {
 	Name             string
-	Level            string
+	Level            Level
 	Label            []string
 	ShortDescription map[string]string
 	Description      map[string]template.HTML
 	Variant          []Variant
+	Examples         []*Example
+	// The modes the entry can be used in, empty for all modes
+	Modes []Mode
+	// The environments the entry can be used in directly (\item in
+	// itemize), empty for all environments
+	Parents []string
+	// Names of related commands and environments
+	SeeAlso []string
+	History
+	// The file the entry has been read from (not written to XML)
+	Origin string
 }
 
 // Packages
@@ -148,17 +437,23 @@ type Packageoption struct {
 	Name             string
 	Default          bool
 	ShortDescription map[string]string
+	OptionValue
+	History
 }
 
 type Package struct {
 	Name             string
-	Level            string
+	Level            Level
 	Label            []string
 	LoadsPackages    []string
 	ShortDescription map[string]string
 	Description      map[string]template.HTML
 	Commands         Commands
 	Options          []*Packageoption
+	Examples         []*Example
+	History
+	// The file the entry has been read from (not written to XML)
+	Origin string
 }
 
 type Packages []*Package
@@ -179,11 +474,22 @@ func (slice Packages) Swap(i, j int) {
 
 type Environment struct {
 	Name             string
-	Level            string
+	Level            Level
 	Label            []string
 	ShortDescription map[string]string
 	Description      map[string]template.HTML
 	Variant          []Variant
+	Examples         []*Example
+	// The modes the entry can be used in, empty for all modes
+	Modes []Mode
+	// The environments the entry can be used in directly (\item in
+	// itemize), empty for all environments
+	Parents []string
+	// Names of related commands and environments
+	SeeAlso []string
+	History
+	// The file the entry has been read from (not written to XML)
+	Origin string
 }
 
 func NewEnvironment() *Environment {
@@ -221,10 +527,14 @@ type Variant struct {
 	Name        string
 	Arguments   []*Argument
 	Description map[string]template.HTML
+	Examples    []*Example
+	History
 }
 
 func NewArgument() *Argument {
-	return &Argument{}
+	a := &Argument{}
+	a.Description = make(map[string]template.HTML)
+	return a
 }
 
 // Argument of a command or an environment
@@ -232,4 +542,42 @@ type Argument struct {
 	Optional bool
 	Name     string
 	Type     Argumenttype
+	// The token of a TOKEN argument, the opening and closing characters of a
+	// DELIMITED argument or the character of an EMBELLISHMENT
+	Delimiters string
+	// The value of an optional argument if it is not given
+	Default string
+	// HasDefault is set if a default value is given, which might be empty
+	// as in O{}
+	HasDefault bool
+	// A long argument may contain \par (+ in xparse)
+	Long bool
+	// What the argument is for, per language
+	Description map[string]template.HTML
+	// The valid keys of a KEYVALLIST argument
+	Keys []*Key
+}
+
+// hasDefault also accepts a default value set without HasDefault.
+func (a *Argument) hasDefault() bool {
+	return a.HasDefault || a.Default != ""
+}
+
+func NewKey() *Key {
+	k := &Key{}
+	k.Description = make(map[string]template.HTML)
+	return k
+}
+
+// Key is a key of a key value list such as width in
+// \includegraphics[width=3cm]{...}.
+type Key struct {
+	Name string
+	Type Valuetype
+	// The allowed values of a CHOICEVALUE key
+	Choices []string
+	// The value used if the key is given without a value
+	Default     string
+	Level       Level
+	Description map[string]template.HTML
 }
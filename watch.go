@@ -0,0 +1,187 @@
+package ltxref
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReloadEvent is sent to the subscribers of a Watcher each time the watched
+// file has changed. If the new file could not be read or is not valid, Err is
+// set and the previous version stays active.
+type ReloadEvent struct {
+	Changes Changeset
+	Err     error
+}
+
+// A Watcher polls an XML file and the files it includes and loads it into a
+// Store whenever one of the files changes on disk.
+type Watcher struct {
+	filename string
+	store    *Store
+	interval time.Duration
+
+	// the files read by the last reload attempt
+	files map[string]fileState
+	// set if the reload has been put off because the main file was missing
+	deferred bool
+
+	mu          sync.Mutex // protects subscribers
+	subscribers map[chan ReloadEvent]bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// fileState is the modification time and size of a watched file. The size
+// is -1 if the file does not exist.
+type fileState struct {
+	modtime time.Time
+	size    int64
+}
+
+func statFile(filename string) fileState {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return fileState{size: -1}
+	}
+	return fileState{modtime: fi.ModTime(), size: fi.Size()}
+}
+
+func (st fileState) equal(other fileState) bool {
+	return st.size == other.size && st.modtime.Equal(other.modtime)
+}
+
+// WatchXMLFile reads the file and returns a Watcher that checks the file and
+// the included files for modifications every interval. The reference is
+// available through Watcher.Store. Call Close to stop watching.
+func WatchXMLFile(filename string, interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("watch %s: invalid interval %s", filename, interval)
+	}
+	w := &Watcher{
+		filename:    filename,
+		interval:    interval,
+		subscribers: make(map[chan ReloadEvent]bool),
+		done:        make(chan struct{}),
+	}
+	l, err := w.load(nil)
+	if err != nil {
+		return nil, err
+	}
+	w.store = NewStore(l)
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// load reads and validates the file and sets w.files to the files read. The
+// state of a file is taken from known if it is in there, so that a change
+// while reading triggers another reload.
+func (w *Watcher) load(known map[string]fileState) (*Ltxref, error) {
+	l, files, err := readXMLFile(w.filename)
+	w.files = make(map[string]fileState, len(files))
+	for _, f := range files {
+		st, ok := known[f]
+		if !ok {
+			st = statFile(f)
+		}
+		w.files[f] = st
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = l.Validate(); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Store returns the store that holds the current version of the file.
+func (w *Watcher) Store() *Store {
+	return w.store
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check reloads the file if the modification time or size of one of the
+// files read by the last reload attempt has changed. A missing included file
+// is a change, the error is sent to the subscribers.
+func (w *Watcher) check() {
+	current := make(map[string]fileState, len(w.files))
+	changed := false
+	for f, old := range w.files {
+		st := statFile(f)
+		current[f] = st
+		changed = changed || !st.equal(old)
+	}
+	if !changed {
+		return
+	}
+	if current[w.filename].size < 0 && !w.deferred {
+		// The file might be in the middle of being replaced, so try
+		// again on the next tick.
+		w.deferred = true
+		return
+	}
+	w.deferred = false
+	l, err := w.load(current)
+	if err != nil {
+		w.notify(ReloadEvent{Err: err})
+		return
+	}
+	old := w.store.Snapshot()
+	w.store.Replace(l)
+	w.notify(ReloadEvent{Changes: Diff(old, l)})
+}
+
+func (w *Watcher) notify(event ReloadEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives an event after each reload
+// attempt. Events are dropped if the channel buffer (of size buffer) is full.
+// The returned function cancels the subscription and closes the channel.
+func (w *Watcher) Subscribe(buffer int) (<-chan ReloadEvent, func()) {
+	ch := make(chan ReloadEvent, buffer)
+	w.mu.Lock()
+	w.subscribers[ch] = true
+	w.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			w.mu.Lock()
+			delete(w.subscribers, ch)
+			w.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// Close stops watching the file. The store keeps the last loaded version.
+func (w *Watcher) Close() {
+	close(w.done)
+	w.wg.Wait()
+}
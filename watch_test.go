@@ -0,0 +1,96 @@
+package ltxref
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestFile replaces the file atomically, so that the watcher never sees
+// a partly written file.
+func writeTestFile(t *testing.T, filename string, data string) {
+	t.Helper()
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitReload(t *testing.T, ch <-chan ReloadEvent) ReloadEvent {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload event")
+	}
+	return ReloadEvent{}
+}
+
+func TestWatchXMLFile(t *testing.T) {
+	dir := t.TempDir()
+	mainfile := filepath.Join(dir, "main.xml")
+	incfile := filepath.Join(dir, "inc.xml")
+	writeTestFile(t, mainfile, `<ltxref version="1"><command name="\a" level="beginner"/><include href="inc.xml"/></ltxref>`)
+	writeTestFile(t, incfile, `<ltxref><command name="\b" level="beginner"/></ltxref>`)
+
+	if _, err := WatchXMLFile(mainfile, 0); err == nil {
+		t.Error("no error for interval 0")
+	}
+	w, err := WatchXMLFile(mainfile, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	ch, cancel := w.Subscribe(4)
+	defer cancel()
+	has := func(name string) bool {
+		return w.Store().Snapshot().GetCommandFromPackage(name, "") != nil
+	}
+	if !has(`\a`) || !has(`\b`) {
+		t.Fatal("initial commands missing")
+	}
+
+	// change of the main file
+	writeTestFile(t, mainfile, `<ltxref version="1"><command name="\aa" level="beginner"/><include href="inc.xml"/></ltxref>`)
+	ev := waitReload(t, ch)
+	if ev.Err != nil || len(ev.Changes.Changes) != 2 || !has(`\aa`) {
+		t.Fatalf("main file change: %v %v", ev.Err, ev.Changes.Changes)
+	}
+
+	// change of the included file
+	writeTestFile(t, incfile, `<ltxref><command name="\bb" level="beginner"/></ltxref>`)
+	ev = waitReload(t, ch)
+	if ev.Err != nil || !has(`\bb`) || has(`\b`) {
+		t.Fatalf("include change: %v %v", ev.Err, ev.Changes.Changes)
+	}
+
+	// an invalid file keeps the old version
+	writeTestFile(t, mainfile, `<ltxref version="1"><command name="\aa" level="nosuchlevel"/><include href="inc.xml"/></ltxref>`)
+	ev = waitReload(t, ch)
+	if ev.Err == nil || !has(`\aa`) || !has(`\bb`) {
+		t.Fatalf("invalid file: %v", ev.Err)
+	}
+
+	// a deleted include is an error until the main file no longer includes it
+	writeTestFile(t, mainfile, `<ltxref version="1"><command name="\aa" level="beginner"/><include href="inc.xml"/></ltxref>`)
+	if ev = waitReload(t, ch); ev.Err != nil {
+		t.Fatal(ev.Err)
+	}
+	if err = os.Remove(incfile); err != nil {
+		t.Fatal(err)
+	}
+	ev = waitReload(t, ch)
+	if ev.Err == nil || !has(`\bb`) {
+		t.Fatalf("deleted include: %v", ev.Err)
+	}
+	writeTestFile(t, mainfile, `<ltxref version="2"><command name="\aa" level="beginner"/></ltxref>`)
+	ev = waitReload(t, ch)
+	if ev.Err != nil || w.Store().Snapshot().Version != "2" || has(`\bb`) {
+		t.Fatalf("after removing the include: %v", ev.Err)
+	}
+}
@@ -3,7 +3,12 @@ package ltxref
 import (
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -63,17 +68,43 @@ func marshalShortDescription(eltname string, e *xml.Encoder, desc map[string]str
 	return nil
 }
 
-func (c *Command) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+func marshalSeeAlso(e *xml.Encoder, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
 	var err error
-	if c.Level == "" {
-		c.Level = "beginner"
+	startElt := xml.StartElement{Name: xml.Name{Local: "seealso"}}
+	err = e.EncodeToken(startElt)
+	if err != nil {
+		return err
 	}
+	for _, name := range names {
+		cmdElt := xml.StartElement{Name: xml.Name{Local: "cmd"}}
+		cmdElt.Attr = []xml.Attr{
+			xml.Attr{Name: xml.Name{Local: "name"}, Value: name},
+		}
+		err = e.EncodeToken(cmdElt)
+		if err != nil {
+			return err
+		}
+		err = e.EncodeToken(xml.EndElement{Name: cmdElt.Name})
+		if err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(xml.EndElement{Name: startElt.Name})
+}
+
+func (c *Command) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	var err error
 	cmdstartelt := xml.StartElement{Name: xml.Name{Local: "command"}}
 	cmdstartelt.Attr = []xml.Attr{
 		xml.Attr{Name: xml.Name{Local: "name"}, Value: c.Name},
 		xml.Attr{Name: xml.Name{Local: "label"}, Value: strings.Join(c.Label, ",")},
-		xml.Attr{Name: xml.Name{Local: "level"}, Value: c.Level},
+		xml.Attr{Name: xml.Name{Local: "level"}, Value: c.Level.String()},
 	}
+	cmdstartelt.Attr = marshalContext(cmdstartelt.Attr, c.Modes, c.Parents)
+	cmdstartelt.Attr = marshalHistory(cmdstartelt.Attr, c.History)
 	err = e.EncodeToken(cmdstartelt)
 	if err != nil {
 		return err
@@ -88,11 +119,21 @@ func (c *Command) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 		return err
 	}
 
+	err = e.Encode(c.Examples)
+	if err != nil {
+		return err
+	}
+
 	err = e.Encode(c.Variant)
 	if err != nil {
 		return err
 	}
 
+	err = marshalSeeAlso(e, c.SeeAlso)
+	if err != nil {
+		return err
+	}
+
 	return e.EncodeToken(xml.EndElement{Name: cmdstartelt.Name})
 }
 
@@ -100,15 +141,13 @@ func (node *Environment) MarshalXML(e *xml.Encoder, start xml.StartElement) erro
 	var err error
 	startElt := xml.StartElement{Name: xml.Name{Local: "environment"}}
 
-	if node.Level == "" {
-		node.Level = "beginner"
-	}
-
 	startElt.Attr = []xml.Attr{
 		xml.Attr{Name: xml.Name{Local: "name"}, Value: node.Name},
-		xml.Attr{Name: xml.Name{Local: "level"}, Value: node.Level},
+		xml.Attr{Name: xml.Name{Local: "level"}, Value: node.Level.String()},
 		xml.Attr{Name: xml.Name{Local: "label"}, Value: strings.Join(node.Label, ",")},
 	}
+	startElt.Attr = marshalContext(startElt.Attr, node.Modes, node.Parents)
+	startElt.Attr = marshalHistory(startElt.Attr, node.History)
 
 	err = e.EncodeToken(startElt)
 	if err != nil {
@@ -125,11 +164,21 @@ func (node *Environment) MarshalXML(e *xml.Encoder, start xml.StartElement) erro
 		return err
 	}
 
+	err = e.Encode(node.Examples)
+	if err != nil {
+		return err
+	}
+
 	err = e.Encode(node.Variant)
 	if err != nil {
 		return err
 	}
 
+	err = marshalSeeAlso(e, node.SeeAlso)
+	if err != nil {
+		return err
+	}
+
 	err = e.EncodeToken(xml.EndElement{Name: startElt.Name})
 	if err != nil {
 		return err
@@ -142,16 +191,13 @@ func (node *Package) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	var err error
 	startElt := xml.StartElement{Name: xml.Name{Local: "package"}}
 
-	if node.Level == "" {
-		node.Level = "beginner"
-	}
-
 	startElt.Attr = []xml.Attr{
 		xml.Attr{Name: xml.Name{Local: "name"}, Value: node.Name},
-		xml.Attr{Name: xml.Name{Local: "level"}, Value: node.Level},
+		xml.Attr{Name: xml.Name{Local: "level"}, Value: node.Level.String()},
 		xml.Attr{Name: xml.Name{Local: "label"}, Value: strings.Join(node.Label, ",")},
 		xml.Attr{Name: xml.Name{Local: "loadspackages"}, Value: strings.Join(node.LoadsPackages, ",")},
 	}
+	startElt.Attr = marshalHistory(startElt.Attr, node.History)
 
 	err = e.EncodeToken(startElt)
 	if err != nil {
@@ -168,6 +214,11 @@ func (node *Package) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 		return err
 	}
 
+	err = e.Encode(node.Examples)
+	if err != nil {
+		return err
+	}
+
 	err = e.Encode(node.Options)
 	if err != nil {
 		return err
@@ -190,13 +241,9 @@ func (node *DocumentClass) MarshalXML(e *xml.Encoder, start xml.StartElement) er
 	var err error
 	startElt := xml.StartElement{Name: xml.Name{Local: "documentclass"}}
 
-	if node.Level == "" {
-		node.Level = "beginner"
-	}
-
 	startElt.Attr = []xml.Attr{
 		xml.Attr{Name: xml.Name{Local: "name"}, Value: node.Name},
-		xml.Attr{Name: xml.Name{Local: "level"}, Value: node.Level},
+		xml.Attr{Name: xml.Name{Local: "level"}, Value: node.Level.String()},
 		xml.Attr{Name: xml.Name{Local: "label"}, Value: strings.Join(node.Label, ",")},
 	}
 
@@ -231,6 +278,9 @@ func (node *DocumentClass) MarshalXML(e *xml.Encoder, start xml.StartElement) er
 func (node *Optiongroup) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	var err error
 	startElt := xml.StartElement{Name: xml.Name{Local: "optiongroup"}}
+	if node.Exclusive {
+		startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "exclusive"}, Value: "yes"})
+	}
 
 	err = e.EncodeToken(startElt)
 	if err != nil {
@@ -255,6 +305,76 @@ func (node *Optiongroup) MarshalXML(e *xml.Encoder, start xml.StartElement) erro
 	return nil
 }
 
+// marshalOptionValue adds the attributes for the value of an option. Flags
+// (the default) need no attributes.
+func marshalOptionValue(attr []xml.Attr, ov OptionValue) []xml.Attr {
+	if ov.Kind != FLAGOPTION {
+		attr = append(attr, xml.Attr{Name: xml.Name{Local: "kind"}, Value: ov.Kind.String()})
+	}
+	if ov.Kind == KEYVALOPTION {
+		attr = append(attr, xml.Attr{Name: xml.Name{Local: "valuetype"}, Value: ov.Type.String()})
+	}
+	if len(ov.Values) > 0 {
+		attr = append(attr, xml.Attr{Name: xml.Name{Local: "values"}, Value: strings.Join(ov.Values, ",")})
+	}
+	if ov.DefaultValue != "" {
+		attr = append(attr, xml.Attr{Name: xml.Name{Local: "defaultvalue"}, Value: ov.DefaultValue})
+	}
+	return attr
+}
+
+func (ex *Example) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	startElt := xml.StartElement{Name: xml.Name{Local: "example"}}
+	if ex.Title != "" {
+		startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "title"}, Value: ex.Title})
+	}
+	if ex.Lang != "" {
+		startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "lang"}, Value: ex.Lang})
+	}
+	err := e.EncodeToken(startElt)
+	if err != nil {
+		return err
+	}
+	err = e.EncodeElement(ex.Source, xml.StartElement{Name: xml.Name{Local: "source"}})
+	if err != nil {
+		return err
+	}
+	if ex.Output != "" {
+		err = e.EncodeElement(ex.Output, xml.StartElement{Name: xml.Name{Local: "output"}})
+		if err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(xml.EndElement{Name: startElt.Name})
+}
+
+// marshalContext appends the modes and parents attributes if they are not
+// empty.
+func marshalContext(attr []xml.Attr, modes []Mode, parents []string) []xml.Attr {
+	if len(modes) > 0 {
+		attr = append(attr, xml.Attr{Name: xml.Name{Local: "modes"}, Value: formatModes(modes)})
+	}
+	if len(parents) > 0 {
+		attr = append(attr, xml.Attr{Name: xml.Name{Local: "parents"}, Value: strings.Join(parents, ",")})
+	}
+	return attr
+}
+
+// marshalHistory appends the attributes of the non-empty history fields.
+func marshalHistory(attr []xml.Attr, h History) []xml.Attr {
+	for _, a := range []struct{ name, value string }{
+		{"since", h.Since},
+		{"deprecated", h.Deprecated},
+		{"replacedby", h.ReplacedBy},
+		{"removed", h.Removed},
+	} {
+		if a.value != "" {
+			attr = append(attr, xml.Attr{Name: xml.Name{Local: a.name}, Value: a.value})
+		}
+	}
+	return attr
+}
+
 func (node *Classoption) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	var err error
 	startElt := xml.StartElement{Name: xml.Name{Local: "classoption"}}
@@ -269,6 +389,8 @@ func (node *Classoption) MarshalXML(e *xml.Encoder, start xml.StartElement) erro
 		xml.Attr{Name: xml.Name{Local: "name"}, Value: node.Name},
 		xml.Attr{Name: xml.Name{Local: "default"}, Value: dflt},
 	}
+	startElt.Attr = marshalOptionValue(startElt.Attr, node.OptionValue)
+	startElt.Attr = marshalHistory(startElt.Attr, node.History)
 
 	err = e.EncodeToken(startElt)
 	if err != nil {
@@ -297,6 +419,8 @@ func (node *Packageoption) MarshalXML(e *xml.Encoder, start xml.StartElement) er
 		xml.Attr{Name: xml.Name{Local: "name"}, Value: node.Name},
 		xml.Attr{Name: xml.Name{Local: "default"}, Value: dflt},
 	}
+	startElt.Attr = marshalOptionValue(startElt.Attr, node.OptionValue)
+	startElt.Attr = marshalHistory(startElt.Attr, node.History)
 
 	err = e.EncodeToken(startElt)
 	if err != nil {
@@ -315,6 +439,27 @@ func (node *Packageoption) MarshalXML(e *xml.Encoder, start xml.StartElement) er
 	return nil
 }
 
+func (k *Key) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	startElt := xml.StartElement{Name: xml.Name{Local: "key"}}
+	startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "name"}, Value: k.Name})
+	startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: k.Type.String()})
+	if len(k.Choices) > 0 {
+		startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "choices"}, Value: strings.Join(k.Choices, ",")})
+	}
+	if k.Default != "" {
+		startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "default"}, Value: k.Default})
+	}
+	startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "level"}, Value: k.Level.String()})
+	err := e.EncodeToken(startElt)
+	if err != nil {
+		return err
+	}
+	if err = marshalDescription("description", e, k.Description); err != nil {
+		return err
+	}
+	return e.EncodeToken(xml.EndElement{Name: startElt.Name})
+}
+
 func (a *Argument) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	var err error
 	startElt := xml.StartElement{Name: xml.Name{Local: "argument"}}
@@ -327,11 +472,26 @@ func (a *Argument) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "name"}, Value: a.Name})
 	startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "optional"}, Value: opt})
 	startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: argumentTypeReveseMap[a.Type]})
+	if a.Delimiters != "" {
+		startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "delimiters"}, Value: a.Delimiters})
+	}
+	if a.hasDefault() {
+		startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "default"}, Value: a.Default})
+	}
+	if a.Long {
+		startElt.Attr = append(startElt.Attr, xml.Attr{Name: xml.Name{Local: "long"}, Value: "yes"})
+	}
 
 	err = e.EncodeToken(startElt)
 	if err != nil {
 		return err
 	}
+	if err = marshalDescription("description", e, a.Description); err != nil {
+		return err
+	}
+	if err = e.Encode(a.Keys); err != nil {
+		return err
+	}
 
 	err = e.EncodeToken(xml.EndElement{Name: startElt.Name})
 	if err != nil {
@@ -344,12 +504,14 @@ func (a *Argument) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 func (v *Variant) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	variantStartElt := xml.StartElement{Name: xml.Name{Local: "variant"}}
 	variantStartElt.Attr = append(variantStartElt.Attr, xml.Attr{Name: xml.Name{Local: "name"}, Value: v.Name})
+	variantStartElt.Attr = marshalHistory(variantStartElt.Attr, v.History)
 	err := e.EncodeToken(variantStartElt)
 	if err != nil {
 		return err
 	}
 	e.Encode(v.Arguments)
 	marshalDescription("description", e, v.Description)
+	e.Encode(v.Examples)
 
 	err = e.EncodeToken(xml.EndElement{Name: variantStartElt.Name})
 	if err != nil {
@@ -402,3 +564,155 @@ func (l *Ltxref) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 func (l *Ltxref) ToXML() ([]byte, error) {
 	return xml.Marshal(l)
 }
+
+// WriteXML writes the reference including the XML declaration.
+func (l *Ltxref) WriteXML(w io.Writer) error {
+	data, err := l.ToXML()
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// splitMain is the main file of a reference written by WriteXMLDir. It
+// contains the kernel commands, environments and document classes and
+// includes the package files.
+type splitMain struct {
+	l        *Ltxref
+	includes []string
+}
+
+func (sm splitMain) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	eltname := xml.Name{Local: "ltxref", Space: "urn:speedata.de:2015:latexref"}
+	startelt := xml.StartElement{Name: eltname}
+	startelt.Attr = append(startelt.Attr, xml.Attr{Name: xml.Name{Local: "version"}, Value: sm.l.Version})
+
+	e.Indent("", "  ")
+	err := e.EncodeToken(startelt)
+	if err != nil {
+		return err
+	}
+	err = e.Encode(sm.l.Commands)
+	if err != nil {
+		return err
+	}
+	err = e.Encode(sm.l.Environments)
+	if err != nil {
+		return err
+	}
+	err = e.Encode(sm.l.DocumentClasses)
+	if err != nil {
+		return err
+	}
+	for _, href := range sm.includes {
+		includeElt := xml.StartElement{Name: xml.Name{Local: "include"}}
+		includeElt.Attr = []xml.Attr{
+			xml.Attr{Name: xml.Name{Local: "href"}, Value: href},
+		}
+		err = e.EncodeToken(includeElt)
+		if err != nil {
+			return err
+		}
+		err = e.EncodeToken(xml.EndElement{Name: includeElt.Name})
+		if err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(xml.EndElement{Name: eltname})
+}
+
+// WriteXMLDir writes the reference split into several files: mainfile in dir
+// contains the kernel commands, environments and document classes and
+// includes one file per package in the packages subdirectory of dir (named
+// after the slug of the package name). Package files included by the
+// previous version of mainfile that are not written again are removed, other
+// files are left alone. Use ReadXMLFile(mainfile) or ReadXMLFS to read it
+// back.
+func (l *Ltxref) WriteXMLDir(dir string, mainfile string) error {
+	previous, err := readIncludes(filepath.Join(dir, mainfile))
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Join(dir, "packages"), 0755); err != nil {
+		return err
+	}
+	sm := splitMain{l: l}
+	written := make(map[string]bool)
+	for _, pkg := range l.Packages {
+		href := "packages/" + slug(pkg.Name) + ".xml"
+		pkgref := &Ltxref{Version: l.Version, Packages: Packages{pkg}}
+		if err = writeXMLFile(filepath.Join(dir, filepath.FromSlash(href)), pkgref); err != nil {
+			return err
+		}
+		written[href] = true
+		sm.includes = append(sm.includes, href)
+	}
+	if err = writeXMLFile(filepath.Join(dir, mainfile), sm); err != nil {
+		return err
+	}
+	for _, href := range previous {
+		// only package files written by an earlier call
+		if written[href] || path.Dir(href) != "packages" || path.Ext(href) != ".xml" {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, filepath.FromSlash(href))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIncludes returns the href attributes of the include elements in the
+// file or nil if the file does not exist.
+func readIncludes(filename string) ([]string, error) {
+	r, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var hrefs []string
+	dec := xml.NewDecoder(r)
+	for {
+		t, err := dec.Token()
+		if err == io.EOF {
+			return hrefs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		if v, ok := t.(xml.StartElement); ok && v.Name.Local == "include" {
+			for _, attribute := range v.Attr {
+				if attribute.Name.Local == "href" {
+					hrefs = append(hrefs, attribute.Value)
+				}
+			}
+		}
+	}
+}
+
+func writeXMLFile(filename string, v interface{}) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		w.Close()
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
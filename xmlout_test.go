@@ -0,0 +1,76 @@
+package ltxref
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteXMLDir(t *testing.T) {
+	l := &Ltxref{Version: "1"}
+	for _, name := range []string{"graphicx", "Alegreya", "../escape"} {
+		if _, err := l.AddPackage(name); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.AddCommand(`\cmd`, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd, err := l.AddCommand(`\section`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.ShortDescription["en"] = "Start a section"
+	if _, err = l.AddEnvironment("itemize"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	pkgdir := filepath.Join(dir, "packages")
+	if err = os.MkdirAll(pkgdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// not written by ltxref
+	notes := filepath.Join(pkgdir, "notes.xml")
+	if err = os.WriteFile(notes, []byte("<notes/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mainfile := filepath.Join(dir, "main.xml")
+	if err = l.WriteXMLDir(dir, "main.xml"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ReadXMLFile(mainfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(l, &r); len(d.Changes) != 0 {
+		t.Errorf("read back: %v", d.Changes)
+	}
+	entries, err := os.ReadDir(pkgdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("got %d files in packages, want 4", len(entries))
+	}
+
+	if err = l.RemovePackage("graphicx"); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.WriteXMLDir(dir, "main.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(pkgdir, "graphicx.xml")); !os.IsNotExist(err) {
+		t.Errorf("graphicx.xml not removed: %v", err)
+	}
+	if _, err = os.Stat(notes); err != nil {
+		t.Errorf("notes.xml removed: %v", err)
+	}
+	if r, err = ReadXMLFile(mainfile); err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(l, &r); len(d.Changes) != 0 {
+		t.Errorf("read back after removing a package: %v", d.Changes)
+	}
+}
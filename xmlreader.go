@@ -3,20 +3,49 @@ package ltxref
 import (
 	"bytes"
 	"encoding/xml"
+	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 )
 
+// ReadXMLFile reads the reference from the file. Includes are resolved
+// relative to the directory of the file.
 func ReadXMLFile(filename string) (Ltxref, error) {
+	l, _, err := readXMLFile(filename)
+	return l, err
+}
+
+// readXMLFile is ReadXMLFile that also returns the names of all files read,
+// the included files after the file itself. The files are returned on errors
+// as well.
+func readXMLFile(filename string) (Ltxref, []string, error) {
 	r, err := os.Open(filename)
+	if err != nil {
+		return Ltxref{}, nil, err
+	}
+	defer r.Close()
+	dir := filepath.Dir(filename)
+	xr := &xmlReader{fsys: os.DirFS(dir), prefix: dir, files: []string{filename}}
+	l, err := xr.read(r, filepath.Base(filename))
+	return l, xr.files, err
+}
+
+// ReadXMLFS reads the reference from the file name in fsys. Includes are
+// resolved relative to the including file and must be in fsys as well.
+func ReadXMLFS(fsys fs.FS, name string) (Ltxref, error) {
+	r, err := fsys.Open(name)
 	if err != nil {
 		return Ltxref{}, err
 	}
 	defer r.Close()
-	return ReadXML(r)
+	xr := &xmlReader{fsys: fsys}
+	return xr.read(r, name)
 }
 
 func ReadXMLData(data []byte) (Ltxref, error) {
@@ -24,14 +53,46 @@ func ReadXMLData(data []byte) (Ltxref, error) {
 	return ReadXML(r)
 }
 
+// ReadXML reads the reference from r. Includes cannot be resolved without a
+// file system and are reported as errors, use ReadXMLFile or ReadXMLFS for
+// split references.
 func ReadXML(r io.Reader) (Ltxref, error) {
+	xr := &xmlReader{}
+	return xr.read(r, "")
+}
+
+// xmlReader reads a reference that might be split into several files with
+// <include href="..."/> (or XInclude) elements.
+type xmlReader struct {
+	// fsys is nil if includes are not allowed
+	fsys fs.FS
+	// prefix is prepended to the file names for the origin of the entries
+	prefix string
+	// stack contains the files that are currently read to detect include
+	// cycles
+	stack []string
+	// files contains the files read so far including the prefix, also
+	// those that could not be opened
+	files []string
+}
+
+func (xr *xmlReader) read(r io.Reader, name string) (Ltxref, error) {
 	lr := Ltxref{}
+	var included []Ltxref
 	dec := xml.NewDecoder(r)
 
+	if name != "" {
+		xr.stack = append(xr.stack, name)
+		defer func() { xr.stack = xr.stack[:len(xr.stack)-1] }()
+	}
+
 	for {
 		t, err := dec.Token()
 		if err != nil {
-			break
+			if err == io.EOF {
+				break
+			}
+			return Ltxref{}, err
 		}
 		switch v := t.(type) {
 		case xml.StartElement:
@@ -42,31 +103,98 @@ func ReadXML(r io.Reader) (Ltxref, error) {
 			}
 			switch v.Name.Local {
 			case "command":
-				cmd := readCommand(v.Attr, dec)
+				cmd, err := readCommand(v.Attr, dec)
+				if err != nil {
+					return Ltxref{}, err
+				}
 				lr.Commands = append(lr.Commands, cmd)
 			case "environment":
-				env := readEnvironment(v.Attr, dec)
+				env, err := readEnvironment(v.Attr, dec)
+				if err != nil {
+					return Ltxref{}, err
+				}
 				lr.Environments = append(lr.Environments, env)
 			case "documentclass":
-				lr.DocumentClasses = append(lr.DocumentClasses, readDocumentclass(v.Attr, dec))
+				dc, err := readDocumentclass(v.Attr, dec)
+				if err != nil {
+					return Ltxref{}, err
+				}
+				lr.DocumentClasses = append(lr.DocumentClasses, dc)
 			case "package":
-				pkg := readPackage(v.Attr, dec)
+				pkg, err := readPackage(v.Attr, dec)
+				if err != nil {
+					return Ltxref{}, err
+				}
 				lr.Packages = append(lr.Packages, pkg)
+			case "include":
+				var href string
+				for _, attribute := range v.Attr {
+					if attribute.Name.Local == "href" {
+						href = attribute.Value
+					}
+				}
+				inc, err := xr.include(name, href)
+				if err != nil {
+					return Ltxref{}, err
+				}
+				included = append(included, inc)
 			}
 		case xml.EndElement:
 			switch v.Name.Local {
 			case "ltxref":
+				if name != "" {
+					lr.setOrigin(filepath.Join(xr.prefix, name))
+				}
+				for _, inc := range included {
+					lr.Commands = append(lr.Commands, inc.Commands...)
+					lr.Environments = append(lr.Environments, inc.Environments...)
+					lr.DocumentClasses = append(lr.DocumentClasses, inc.DocumentClasses...)
+					lr.Packages = append(lr.Packages, inc.Packages...)
+					lr.Sources = append(lr.Sources, inc.Sources...)
+				}
 				sort.Sort(lr.Commands)
 				sort.Sort(lr.Environments)
+				if len(included) > 0 {
+					sort.Sort(lr.DocumentClasses)
+					sort.Sort(lr.Packages)
+				}
 				return lr, nil
 			}
 		}
 	}
-	// never reached b/c xml.EndElement catches the closing tag
+	// only reached if there is no closing ltxref element
 	return lr, nil
 }
 
-func readDocumentclass(attributes []xml.Attr, dec *xml.Decoder) *DocumentClass {
+// include reads the file href, which is relative to the file from.
+func (xr *xmlReader) include(from string, href string) (Ltxref, error) {
+	if href == "" {
+		return Ltxref{}, fmt.Errorf("%s: include without href", from)
+	}
+	if xr.fsys == nil {
+		return Ltxref{}, fmt.Errorf("include %s: no file system to read from, use ReadXMLFile or ReadXMLFS", href)
+	}
+	name := path.Join(path.Dir(from), href)
+	if !fs.ValidPath(name) {
+		return Ltxref{}, fmt.Errorf("%s: invalid include %q", from, href)
+	}
+	for i, f := range xr.stack {
+		if f == name {
+			cycle := append(append([]string{}, xr.stack[i:]...), name)
+			return Ltxref{}, fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	xr.files = append(xr.files, filepath.Join(xr.prefix, filepath.FromSlash(name)))
+	r, err := xr.fsys.Open(name)
+	if err != nil {
+		return Ltxref{}, err
+	}
+	defer r.Close()
+	return xr.read(r, name)
+}
+
+func readDocumentclass(attributes []xml.Attr, dec *xml.Decoder) (*DocumentClass, error) {
+	var err error
 	dc := NewDocumentClass()
 	dc.ShortDescription = make(map[string]string)
 	dc.Description = make(map[string]template.HTML)
@@ -75,7 +203,10 @@ func readDocumentclass(attributes []xml.Attr, dec *xml.Decoder) *DocumentClass {
 		case "name":
 			dc.Name = attribute.Value
 		case "level":
-			dc.Level = attribute.Value
+			dc.Level, err = ParseLevel(attribute.Value)
+			if err != nil {
+				return nil, fmt.Errorf("documentclass %s: %s", dc.Name, err)
+			}
 		case "label":
 			dc.Label = strings.Split(attribute.Value, ",")
 		}
@@ -96,7 +227,11 @@ forloop:
 				lang, text := readDescription(v.Attr, dec)
 				dc.Description[lang] = text
 			case "optiongroup":
-				dc.Optiongroup = append(dc.Optiongroup, readOptiongroup(v.Attr, dec))
+				og, err := readOptiongroup(v.Attr, dec)
+				if err != nil {
+					return nil, fmt.Errorf("documentclass %s: %s", dc.Name, err)
+				}
+				dc.Optiongroup = append(dc.Optiongroup, og)
 			}
 		case xml.EndElement:
 			switch v.Name.Local {
@@ -105,11 +240,16 @@ forloop:
 			}
 		}
 	}
-	return dc
+	return dc, nil
 }
-func readOptiongroup(attributes []xml.Attr, dec *xml.Decoder) *Optiongroup {
+func readOptiongroup(attributes []xml.Attr, dec *xml.Decoder) (*Optiongroup, error) {
 	og := &Optiongroup{}
 	og.ShortDescription = make(map[string]string)
+	for _, attribute := range attributes {
+		if attribute.Name.Local == "exclusive" {
+			og.Exclusive = attribute.Value == "yes"
+		}
+	}
 
 forloop:
 	for {
@@ -124,7 +264,11 @@ forloop:
 				lang, text := readShortDescription(v.Attr, dec)
 				og.ShortDescription[lang] = text
 			case "classoption":
-				og.Classoption = append(og.Classoption, readClassoption(v.Attr, dec))
+				co, err := readClassoption(v.Attr, dec)
+				if err != nil {
+					return nil, err
+				}
+				og.Classoption = append(og.Classoption, co)
 			}
 		case xml.EndElement:
 			if v.Name.Local == "optiongroup" {
@@ -132,10 +276,55 @@ forloop:
 			}
 		}
 	}
-	return og
+	return og, nil
 }
 
-func readClassoption(attributes []xml.Attr, dec *xml.Decoder) *Classoption {
+// readOptionValue reads the attributes that describe the value of an
+// option.
+func readOptionValue(attribute xml.Attr, ov *OptionValue) error {
+	var err error
+	switch attribute.Name.Local {
+	case "kind":
+		ov.Kind, err = ParseOptionkind(attribute.Value)
+	case "valuetype":
+		ov.Type, err = ParseValuetype(attribute.Value)
+	case "values":
+		ov.Values = strings.Split(attribute.Value, ",")
+	case "defaultvalue":
+		ov.DefaultValue = attribute.Value
+	}
+	return err
+}
+
+// parseModes parses a comma separated list of modes.
+func parseModes(list string) ([]Mode, error) {
+	var modes []Mode
+	for _, name := range strings.Split(list, ",") {
+		m, err := ParseMode(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		modes = append(modes, m)
+	}
+	return modes, nil
+}
+
+// readHistory reads the since, deprecated, replacedby and removed
+// attributes.
+func readHistory(attribute xml.Attr, h *History) {
+	switch attribute.Name.Local {
+	case "since":
+		h.Since = attribute.Value
+	case "deprecated":
+		h.Deprecated = attribute.Value
+	case "replacedby":
+		h.ReplacedBy = attribute.Value
+	case "removed":
+		h.Removed = attribute.Value
+	}
+}
+
+func readClassoption(attributes []xml.Attr, dec *xml.Decoder) (*Classoption, error) {
 	po := &Classoption{}
 	po.ShortDescription = make(map[string]string)
 
@@ -147,6 +336,12 @@ func readClassoption(attributes []xml.Attr, dec *xml.Decoder) *Classoption {
 			po.Default = attribute.Value == "yes"
 		}
 	}
+	for _, attribute := range attributes {
+		if err := readOptionValue(attribute, &po.OptionValue); err != nil {
+			return nil, fmt.Errorf("classoption %s: %s", po.Name, err)
+		}
+		readHistory(attribute, &po.History)
+	}
 
 forloop:
 	for {
@@ -167,10 +362,10 @@ forloop:
 			}
 		}
 	}
-	return po
+	return po, nil
 }
 
-func readPackageoption(attributes []xml.Attr, dec *xml.Decoder) *Packageoption {
+func readPackageoption(attributes []xml.Attr, dec *xml.Decoder) (*Packageoption, error) {
 	po := &Packageoption{}
 	po.ShortDescription = make(map[string]string)
 
@@ -182,6 +377,12 @@ func readPackageoption(attributes []xml.Attr, dec *xml.Decoder) *Packageoption {
 			po.Default = attribute.Value == "yes"
 		}
 	}
+	for _, attribute := range attributes {
+		if err := readOptionValue(attribute, &po.OptionValue); err != nil {
+			return nil, fmt.Errorf("packageoption %s: %s", po.Name, err)
+		}
+		readHistory(attribute, &po.History)
+	}
 
 forloop:
 	for {
@@ -202,10 +403,51 @@ forloop:
 			}
 		}
 	}
-	return po
+	return po, nil
+}
+
+func readKey(attributes []xml.Attr, dec *xml.Decoder) (*Key, error) {
+	var err error
+	key := NewKey()
+	for _, attribute := range attributes {
+		switch attribute.Name.Local {
+		case "name":
+			key.Name = attribute.Value
+		case "type":
+			if key.Type, err = ParseValuetype(attribute.Value); err != nil {
+				return nil, fmt.Errorf("key %s: %s", key.Name, err)
+			}
+		case "choices":
+			key.Choices = strings.Split(attribute.Value, ",")
+		case "default":
+			key.Default = attribute.Value
+		case "level":
+			if key.Level, err = ParseLevel(attribute.Value); err != nil {
+				return nil, fmt.Errorf("key %s: %s", key.Name, err)
+			}
+		}
+	}
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch v := t.(type) {
+		case xml.StartElement:
+			if v.Name.Local == "description" {
+				lang, text := readDescription(v.Attr, dec)
+				key.Description[lang] = text
+			}
+		case xml.EndElement:
+			if v.Name.Local == "key" {
+				return key, nil
+			}
+		}
+	}
+	return key, nil
 }
 
-func readArgument(attributes []xml.Attr, dec *xml.Decoder) *Argument {
+func readArgument(attributes []xml.Attr, dec *xml.Decoder) (*Argument, error) {
 	argument := NewArgument()
 	for _, attribute := range attributes {
 		switch attribute.Name.Local {
@@ -215,18 +457,50 @@ func readArgument(attributes []xml.Attr, dec *xml.Decoder) *Argument {
 			argument.Optional = attribute.Value == "yes"
 		case "type":
 			argument.Type = argumenttypemap[attribute.Value]
+		case "delimiters":
+			argument.Delimiters = attribute.Value
+		case "default":
+			argument.Default = attribute.Value
+			argument.HasDefault = true
+		case "long":
+			argument.Long = attribute.Value == "yes"
 		}
 	}
-	return argument
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch v := t.(type) {
+		case xml.StartElement:
+			switch v.Name.Local {
+			case "description":
+				lang, text := readDescription(v.Attr, dec)
+				argument.Description[lang] = text
+			case "key":
+				key, err := readKey(v.Attr, dec)
+				if err != nil {
+					return nil, fmt.Errorf("argument %s: %s", argument.Name, err)
+				}
+				argument.Keys = append(argument.Keys, key)
+			}
+		case xml.EndElement:
+			if v.Name.Local == "argument" {
+				return argument, nil
+			}
+		}
+	}
+	return argument, nil
 }
 
-func readVariant(attributes []xml.Attr, dec *xml.Decoder) Variant {
+func readVariant(attributes []xml.Attr, dec *xml.Decoder) (Variant, error) {
 	variant := Variant{}
 	variant.Description = make(map[string]template.HTML)
 	for _, attribute := range attributes {
 		if attribute.Name.Local == "name" {
 			variant.Name = attribute.Value
 		}
+		readHistory(attribute, &variant.History)
 	}
 	for {
 		t, err := dec.Token()
@@ -237,21 +511,28 @@ func readVariant(attributes []xml.Attr, dec *xml.Decoder) Variant {
 		case xml.StartElement:
 			switch v.Name.Local {
 			case "argument":
-				variant.Arguments = append(variant.Arguments, readArgument(v.Attr, dec))
+				argument, err := readArgument(v.Attr, dec)
+				if err != nil {
+					return variant, fmt.Errorf("variant %s: %s", variant.Name, err)
+				}
+				variant.Arguments = append(variant.Arguments, argument)
 			case "description":
 				lang, text := readDescription(v.Attr, dec)
 				variant.Description[lang] = text
+			case "example":
+				variant.Examples = append(variant.Examples, readExample(v.Attr, dec))
 			}
 		case xml.EndElement:
 			if v.Name.Local == "variant" {
-				return variant
+				return variant, nil
 			}
 		}
 	}
-	return variant
+	return variant, nil
 }
 
-func readPackage(attributes []xml.Attr, dec *xml.Decoder) *Package {
+func readPackage(attributes []xml.Attr, dec *xml.Decoder) (*Package, error) {
+	var err error
 	pkg := &Package{}
 	pkg.ShortDescription = make(map[string]string)
 	pkg.Description = make(map[string]template.HTML)
@@ -260,11 +541,16 @@ func readPackage(attributes []xml.Attr, dec *xml.Decoder) *Package {
 		case "name":
 			pkg.Name = attribute.Value
 		case "level":
-			pkg.Level = attribute.Value
+			pkg.Level, err = ParseLevel(attribute.Value)
+			if err != nil {
+				return nil, fmt.Errorf("package %s: %s", pkg.Name, err)
+			}
 		case "label":
 			pkg.Label = strings.Split(attribute.Value, ",")
 		case "loadspackages":
 			pkg.LoadsPackages = strings.Split(attribute.Value, ",")
+		default:
+			readHistory(attribute, &pkg.History)
 
 		}
 	}
@@ -282,23 +568,34 @@ func readPackage(attributes []xml.Attr, dec *xml.Decoder) *Package {
 			case "description":
 				lang, text := readDescription(v.Attr, dec)
 				pkg.Description[lang] = text
+			case "example":
+				pkg.Examples = append(pkg.Examples, readExample(v.Attr, dec))
 			case "packageoption":
-				pkg.Options = append(pkg.Options, readPackageoption(v.Attr, dec))
+				po, err := readPackageoption(v.Attr, dec)
+				if err != nil {
+					return nil, fmt.Errorf("package %s: %s", pkg.Name, err)
+				}
+				pkg.Options = append(pkg.Options, po)
 			case "command":
-				pkg.Commands = append(pkg.Commands, readCommand(v.Attr, dec))
+				cmd, err := readCommand(v.Attr, dec)
+				if err != nil {
+					return nil, fmt.Errorf("package %s: %s", pkg.Name, err)
+				}
+				pkg.Commands = append(pkg.Commands, cmd)
 			}
 		case xml.EndElement:
 			switch v.Name.Local {
 			case "package":
-				return pkg
+				return pkg, nil
 			}
 		}
 
 	}
-	return pkg
+	return pkg, nil
 }
 
-func readEnvironment(attributes []xml.Attr, dec *xml.Decoder) *Environment {
+func readEnvironment(attributes []xml.Attr, dec *xml.Decoder) (*Environment, error) {
+	var err error
 	env := &Environment{}
 	env.ShortDescription = make(map[string]string)
 	env.Description = make(map[string]template.HTML)
@@ -307,9 +604,21 @@ func readEnvironment(attributes []xml.Attr, dec *xml.Decoder) *Environment {
 		case "name":
 			env.Name = attribute.Value
 		case "level":
-			env.Level = attribute.Value
+			env.Level, err = ParseLevel(attribute.Value)
+			if err != nil {
+				return nil, fmt.Errorf("environment %s: %s", env.Name, err)
+			}
 		case "label":
 			env.Label = strings.Split(attribute.Value, ",")
+		case "modes":
+			env.Modes, err = parseModes(attribute.Value)
+			if err != nil {
+				return nil, fmt.Errorf("environment %s: %s", env.Name, err)
+			}
+		case "parents":
+			env.Parents = strings.Split(attribute.Value, ",")
+		default:
+			readHistory(attribute, &env.History)
 		}
 	}
 	for {
@@ -326,22 +635,30 @@ func readEnvironment(attributes []xml.Attr, dec *xml.Decoder) *Environment {
 			case "description":
 				lang, text := readDescription(v.Attr, dec)
 				env.Description[lang] = text
+			case "example":
+				env.Examples = append(env.Examples, readExample(v.Attr, dec))
 			case "variant":
-				variant := readVariant(v.Attr, dec)
+				variant, err := readVariant(v.Attr, dec)
+				if err != nil {
+					return nil, fmt.Errorf("environment %s: %s", env.Name, err)
+				}
 				env.Variant = append(env.Variant, variant)
+			case "seealso":
+				env.SeeAlso = readSeeAlso(dec)
 			}
 		case xml.EndElement:
 			switch v.Name.Local {
 			case "environment":
-				return env
+				return env, nil
 			}
 		}
 
 	}
-	return env
+	return env, nil
 }
 
-func readCommand(attributes []xml.Attr, dec *xml.Decoder) *Command {
+func readCommand(attributes []xml.Attr, dec *xml.Decoder) (*Command, error) {
+	var err error
 	cmd := NewCommand()
 
 	for _, attribute := range attributes {
@@ -349,9 +666,21 @@ func readCommand(attributes []xml.Attr, dec *xml.Decoder) *Command {
 		case "name":
 			cmd.Name = attribute.Value
 		case "level":
-			cmd.Level = attribute.Value
+			cmd.Level, err = ParseLevel(attribute.Value)
+			if err != nil {
+				return nil, fmt.Errorf("command %s: %s", cmd.Name, err)
+			}
 		case "label":
 			cmd.Label = strings.Split(attribute.Value, ",")
+		case "modes":
+			cmd.Modes, err = parseModes(attribute.Value)
+			if err != nil {
+				return nil, fmt.Errorf("command %s: %s", cmd.Name, err)
+			}
+		case "parents":
+			cmd.Parents = strings.Split(attribute.Value, ",")
+		default:
+			readHistory(attribute, &cmd.History)
 		}
 	}
 
@@ -369,20 +698,89 @@ func readCommand(attributes []xml.Attr, dec *xml.Decoder) *Command {
 			case "description":
 				lang, text := readDescription(v.Attr, dec)
 				cmd.Description[lang] = text
+			case "example":
+				cmd.Examples = append(cmd.Examples, readExample(v.Attr, dec))
 			case "variant":
-				variant := readVariant(v.Attr, dec)
+				variant, err := readVariant(v.Attr, dec)
+				if err != nil {
+					return nil, fmt.Errorf("command %s: %s", cmd.Name, err)
+				}
 				cmd.Variant = append(cmd.Variant, variant)
+			case "seealso":
+				cmd.SeeAlso = readSeeAlso(dec)
 			}
 		case xml.EndElement:
 			switch v.Name.Local {
 			case "command":
-				return cmd
+				return cmd, nil
 			}
 
 		}
 
 	}
-	return cmd
+	return cmd, nil
+}
+
+// readSeeAlso returns the names of the <cmd> elements in <seealso>. The text
+// between the elements is ignored.
+func readSeeAlso(dec *xml.Decoder) []string {
+	var names []string
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch v := t.(type) {
+		case xml.StartElement:
+			if v.Name.Local == "cmd" {
+				for _, attribute := range v.Attr {
+					if attribute.Name.Local == "name" {
+						names = append(names, attribute.Value)
+					}
+				}
+			}
+		case xml.EndElement:
+			if v.Name.Local == "seealso" {
+				return names
+			}
+		}
+	}
+	return names
+}
+
+func readExample(attributes []xml.Attr, dec *xml.Decoder) *Example {
+	ex := &Example{}
+	for _, attribute := range attributes {
+		switch attribute.Name.Local {
+		case "title":
+			ex.Title = attribute.Value
+		case "lang":
+			ex.Lang = attribute.Value
+		}
+	}
+	var text string
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch v := t.(type) {
+		case xml.StartElement:
+			text = ""
+		case xml.CharData:
+			text += string(v)
+		case xml.EndElement:
+			switch v.Name.Local {
+			case "source":
+				ex.Source = text
+			case "output":
+				ex.Output = text
+			case "example":
+				return ex
+			}
+		}
+	}
+	return ex
 }
 
 func readDescription(attributes []xml.Attr, dec *xml.Decoder) (string, template.HTML) {
@@ -0,0 +1,58 @@
+package ltxref
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadXMLFSInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.xml":          {Data: []byte(`<ltxref version="1"><command name="\a"/><include href="pkgs/graphicx.xml"/></ltxref>`)},
+		"pkgs/graphicx.xml": {Data: []byte(`<ltxref><package name="graphicx"><command name="\includegraphics"/></package><include href="../env.xml"/></ltxref>`)},
+		"env.xml":           {Data: []byte(`<ltxref xmlns:xi="http://www.w3.org/2001/XInclude"><environment name="itemize"/></ltxref>`)},
+	}
+	l, err := ReadXMLFS(fsys, "main.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Version != "1" {
+		t.Errorf("version %q", l.Version)
+	}
+	if l.GetCommandFromPackage(`\a`, "") == nil || l.GetCommandFromPackage(`\includegraphics`, "graphicx") == nil || l.GetEnvironmentWithName("itemize") == nil {
+		t.Errorf("included entries missing: %+v", l)
+	}
+	if origin := l.GetPackageWithName("graphicx").Origin; origin != "pkgs/graphicx.xml" {
+		t.Errorf("origin %q", origin)
+	}
+}
+
+func TestReadXMLIncludeErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.xml":       {Data: []byte(`<ltxref><include href="sub/b.xml"/></ltxref>`)},
+		"sub/b.xml":   {Data: []byte(`<ltxref xmlns:xi="http://www.w3.org/2001/XInclude"><xi:include href="../a.xml"/></ltxref>`)},
+		"self.xml":    {Data: []byte(`<ltxref><include href="self.xml"/></ltxref>`)},
+		"missing.xml": {Data: []byte(`<ltxref><include href="nothere.xml"/></ltxref>`)},
+		"nohref.xml":  {Data: []byte(`<ltxref><include/></ltxref>`)},
+		"escape.xml":  {Data: []byte(`<ltxref><include href="../outside.xml"/></ltxref>`)},
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"a.xml", "include cycle: a.xml -> sub/b.xml -> a.xml"},
+		{"self.xml", "include cycle: self.xml -> self.xml"},
+		{"missing.xml", "nothere.xml"},
+		{"nohref.xml", "include without href"},
+		{"escape.xml", "invalid include"},
+	}
+	for _, tt := range tests {
+		_, err := ReadXMLFS(fsys, tt.name)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := ReadXML(strings.NewReader(`<ltxref><include href="a.xml"/></ltxref>`)); err == nil {
+		t.Error("ReadXML resolved an include without a file system")
+	}
+}
@@ -0,0 +1,272 @@
+package ltxref
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseArgSpec parses an xparse argument specification such as "s O{x} m"
+// and returns the arguments. The arguments are named arg1, arg2, ... in the
+// order of the parameters #1, #2, ...
+func ParseArgSpec(spec string) ([]*Argument, error) {
+	args := []*Argument{}
+	s := spec
+	long := false
+	add := func(a *Argument) {
+		a.Long = long
+		a.Name = "arg" + strconv.Itoa(len(args)+1)
+		args = append(args, a)
+		long = false
+	}
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		if s == "" {
+			break
+		}
+		c := s[0]
+		s = s[1:]
+		var err error
+		switch c {
+		case '+':
+			long = true
+			continue
+		case '!', '>':
+			return nil, fmt.Errorf("xparse spec %q: %c is not supported", spec, c)
+		case 'm':
+			add(&Argument{Type: MANDARG})
+		case 'v':
+			add(&Argument{Type: VERBATIM})
+		case 'b':
+			add(&Argument{Type: BODY})
+		case 's':
+			add(&Argument{Type: STAR, Optional: true})
+		case 'o', 'O':
+			a := &Argument{Type: OPTARG, Optional: true}
+			if c == 'O' {
+				if a.Default, s, err = specGroup(s); err != nil {
+					return nil, fmt.Errorf("xparse spec %q: %s", spec, err)
+				}
+				a.HasDefault = true
+			}
+			add(a)
+		case 't':
+			a := &Argument{Type: TOKEN, Optional: true}
+			if a.Delimiters, s, err = specTokens(s, 1); err != nil {
+				return nil, fmt.Errorf("xparse spec %q: %s", spec, err)
+			}
+			add(a)
+		case 'd', 'D', 'r', 'R':
+			a := &Argument{Type: DELIMITED, Optional: c == 'd' || c == 'D'}
+			if a.Delimiters, s, err = specTokens(s, 2); err != nil {
+				return nil, fmt.Errorf("xparse spec %q: %s", spec, err)
+			}
+			if c == 'D' || c == 'R' {
+				if a.Default, s, err = specGroup(s); err != nil {
+					return nil, fmt.Errorf("xparse spec %q: %s", spec, err)
+				}
+				a.HasDefault = true
+			}
+			add(a)
+		case 'e', 'E':
+			var tokens, defaults string
+			if tokens, s, err = specGroup(s); err != nil {
+				return nil, fmt.Errorf("xparse spec %q: %s", spec, err)
+			}
+			var values []string
+			if c == 'E' {
+				if defaults, s, err = specGroup(s); err != nil {
+					return nil, fmt.Errorf("xparse spec %q: %s", spec, err)
+				}
+				for defaults = strings.TrimSpace(defaults); defaults != ""; defaults = strings.TrimSpace(defaults) {
+					var value string
+					if value, defaults, err = specGroup(defaults); err != nil {
+						return nil, fmt.Errorf("xparse spec %q: %s", spec, err)
+					}
+					values = append(values, value)
+				}
+			}
+			for i, r := range []rune(tokens) {
+				a := &Argument{Type: EMBELLISHMENT, Optional: true, Delimiters: string(r)}
+				if i < len(values) {
+					a.Default = values[i]
+					a.HasDefault = true
+				}
+				add(a)
+			}
+		default:
+			return nil, fmt.Errorf("xparse spec %q: unknown argument type %c", spec, c)
+		}
+	}
+	if long {
+		return nil, fmt.Errorf("xparse spec %q: + without argument", spec)
+	}
+	return args, nil
+}
+
+// specGroup returns the contents of the brace group at the start of s and
+// the rest of s.
+func specGroup(s string) (string, string, error) {
+	s = strings.TrimLeft(s, " \t\n")
+	if s == "" || s[0] != '{' {
+		return "", s, fmt.Errorf("missing {")
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[1:i], s[i+1:], nil
+			}
+		}
+	}
+	return "", s, fmt.Errorf("missing }")
+}
+
+// specTokens returns the next n characters of s. A token may be given in
+// braces.
+func specTokens(s string, n int) (string, string, error) {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		s = strings.TrimLeft(s, " \t\n")
+		if s == "" {
+			return "", s, fmt.Errorf("missing delimiter")
+		}
+		if s[0] == '{' {
+			tok, rest, err := specGroup(s)
+			if err != nil {
+				return "", s, err
+			}
+			if utf8.RuneCountInString(tok) != 1 {
+				return "", s, fmt.Errorf("delimiter %q is not a single character", tok)
+			}
+			sb.WriteString(tok)
+			s = rest
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		sb.WriteRune(r)
+		s = s[size:]
+	}
+	return sb.String(), s, nil
+}
+
+// FormatArgSpec returns the xparse argument specification for the
+// arguments. Consecutive embellishments are combined. Arguments without an
+// xparse equivalent (TODIMENORSPREADDIMEN) cause an error.
+func FormatArgSpec(args []*Argument) (string, error) {
+	var parts []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		prefix := ""
+		if a.Long {
+			prefix = "+"
+		}
+		var part string
+		switch a.Type {
+		case MANDARG, MANDLIST:
+			part = "m"
+		case OPTARG, OPTLIST, KEYVALLIST:
+			if !a.Optional {
+				part = "m"
+			} else if a.hasDefault() {
+				part = "O{" + a.Default + "}"
+			} else {
+				part = "o"
+			}
+		case VERBATIM:
+			part = "v"
+		case BODY:
+			part = "b"
+		case STAR:
+			part = "s"
+		case TOKEN:
+			part = "t" + a.Delimiters
+		case DELIMITED:
+			if utf8.RuneCountInString(a.Delimiters) != 2 {
+				return "", fmt.Errorf("argument %s: delimited argument needs two delimiters", a.Name)
+			}
+			c := "r"
+			if a.Optional {
+				c = "d"
+			}
+			if a.hasDefault() {
+				part = strings.ToUpper(c) + a.Delimiters + "{" + a.Default + "}"
+			} else {
+				part = c + a.Delimiters
+			}
+		case EMBELLISHMENT:
+			tokens := ""
+			defaults := ""
+			hasDefault := false
+			for ; i < len(args) && args[i].Type == EMBELLISHMENT && args[i].Long == a.Long; i++ {
+				tokens += args[i].Delimiters
+				defaults += "{" + args[i].Default + "}"
+				hasDefault = hasDefault || args[i].hasDefault()
+			}
+			i--
+			if hasDefault {
+				part = "E{" + tokens + "}{" + defaults + "}"
+			} else {
+				part = "e{" + tokens + "}"
+			}
+		default:
+			return "", fmt.Errorf("argument %s: type %s has no xparse equivalent", a.Name, argumentTypeReveseMap[a.Type])
+		}
+		parts = append(parts, prefix+part)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// ParseDocumentCommand parses a definition such as
+// \NewDocumentCommand\foo{s O{x} m}{...} and returns the command name and
+// its arguments. The code after the argument specification is ignored.
+func ParseDocumentCommand(def string) (string, []*Argument, error) {
+	def = strings.TrimSpace(def)
+	definer := cwlCommandName(def)
+	switch definer {
+	case `\NewDocumentCommand`, `\RenewDocumentCommand`, `\ProvideDocumentCommand`, `\DeclareDocumentCommand`:
+	default:
+		return "", nil, fmt.Errorf("%q is not a document command definition", def)
+	}
+	rest := strings.TrimLeft(def[len(definer):], " \t\n")
+	var name string
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		if name, rest, err = specGroup(rest); err != nil {
+			return "", nil, err
+		}
+		name = strings.TrimSpace(name)
+	} else if strings.HasPrefix(rest, `\`) {
+		name = cwlCommandName(rest)
+		rest = rest[len(name):]
+	}
+	if err := checkCommandName(name); err != nil {
+		return "", nil, err
+	}
+	spec, _, err := specGroup(rest)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: argument specification: %s", name, err)
+	}
+	args, err := ParseArgSpec(spec)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, args, nil
+}
+
+// FormatDocumentCommand returns the \NewDocumentCommand line for the variant
+// without the code part.
+func FormatDocumentCommand(v Variant) (string, error) {
+	spec, err := FormatArgSpec(v.Arguments)
+	if err != nil {
+		return "", err
+	}
+	return `\NewDocumentCommand` + v.Name + "{" + spec + "}", nil
+}
@@ -0,0 +1,145 @@
+package ltxref
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseArgSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		args []Argument
+	}{
+		{"", []Argument{}},
+		{"s O{x} m", []Argument{
+			{Name: "arg1", Type: STAR, Optional: true},
+			{Name: "arg2", Type: OPTARG, Optional: true, Default: "x", HasDefault: true},
+			{Name: "arg3", Type: MANDARG},
+		}},
+		{"O{} +m t+ d() R<>{z} E{^_}{{a}{}} b v", []Argument{
+			{Name: "arg1", Type: OPTARG, Optional: true, HasDefault: true},
+			{Name: "arg2", Type: MANDARG, Long: true},
+			{Name: "arg3", Type: TOKEN, Optional: true, Delimiters: "+"},
+			{Name: "arg4", Type: DELIMITED, Optional: true, Delimiters: "()"},
+			{Name: "arg5", Type: DELIMITED, Delimiters: "<>", Default: "z", HasDefault: true},
+			{Name: "arg6", Type: EMBELLISHMENT, Optional: true, Delimiters: "^", Default: "a", HasDefault: true},
+			{Name: "arg7", Type: EMBELLISHMENT, Optional: true, Delimiters: "_", HasDefault: true},
+			{Name: "arg8", Type: BODY},
+			{Name: "arg9", Type: VERBATIM},
+		}},
+		{"o e{_} D{(}{)}{0} r{[}]", []Argument{
+			{Name: "arg1", Type: OPTARG, Optional: true},
+			{Name: "arg2", Type: EMBELLISHMENT, Optional: true, Delimiters: "_"},
+			{Name: "arg3", Type: DELIMITED, Optional: true, Delimiters: "()", Default: "0", HasDefault: true},
+			{Name: "arg4", Type: DELIMITED, Delimiters: "[]"},
+		}},
+	}
+	for _, tt := range tests {
+		args, err := ParseArgSpec(tt.spec)
+		if err != nil {
+			t.Errorf("ParseArgSpec(%q): %v", tt.spec, err)
+			continue
+		}
+		got := []Argument{}
+		for _, a := range args {
+			got = append(got, *a)
+		}
+		if !reflect.DeepEqual(got, tt.args) {
+			t.Errorf("ParseArgSpec(%q) = %+v, want %+v", tt.spec, got, tt.args)
+		}
+	}
+}
+
+func TestParseArgSpecErrors(t *testing.T) {
+	for _, spec := range []string{"!o", ">{\\SplitList{;}}m", "m +", "O{x", "D()", "t", "E{^}{{a}", "q"} {
+		if _, err := ParseArgSpec(spec); err == nil {
+			t.Errorf("ParseArgSpec(%q): no error", spec)
+		}
+	}
+}
+
+func TestFormatArgSpec(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"s O{x} m",
+		"O{} +m t+ d() R<>{z} E{^_}{{a}{}} b v",
+		"o e{_} D(){0} r[]",
+	} {
+		args, err := ParseArgSpec(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := FormatArgSpec(args); err != nil || got != spec {
+			t.Errorf("FormatArgSpec(ParseArgSpec(%q)) = %q, %v", spec, got, err)
+		}
+	}
+	if _, err := FormatArgSpec([]*Argument{{Name: "x", Type: TODIMENORSPREADDIMEN}}); err == nil {
+		t.Error("no error for TODIMENORSPREADDIMEN")
+	}
+}
+
+func TestDocumentCommandRoundTrip(t *testing.T) {
+	const def = `\NewDocumentCommand\foo{s O{x} m}`
+	name, args, err := ParseDocumentCommand(def + `{code #1 #2 #3}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != `\foo` || len(args) != 3 {
+		t.Fatalf("got %s with %d arguments", name, len(args))
+	}
+	if n, _, err := ParseDocumentCommand(`\DeclareDocumentCommand {\foo} {s O{x} m} {}`); err != nil || n != `\foo` {
+		t.Errorf("braced name: got %q, %v", n, err)
+	}
+	for _, bad := range []string{`\newcommand\foo{x}`, `\NewDocumentCommand foo{m}{}`, `\NewDocumentCommand\foo{m`} {
+		if _, _, err := ParseDocumentCommand(bad); err == nil {
+			t.Errorf("ParseDocumentCommand(%q): no error", bad)
+		}
+	}
+
+	v := NewVariant()
+	v.Name = name
+	v.Arguments = args
+	if got, err := FormatDocumentCommand(*v); err != nil || got != def {
+		t.Errorf("FormatDocumentCommand = %q, %v, want %q", got, err, def)
+	}
+
+	// the arguments survive a round trip through the XML file
+	l := &Ltxref{Version: "1"}
+	cmd, err := l.AddCommand(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Variant = []Variant{*v}
+	const spec = "O{} +m t+ d() R<>{z} E{^_}{{a}{}} b v"
+	bar, err := l.AddCommand(`\bar`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bv := NewVariant()
+	bv.Name = `\bar`
+	if bv.Arguments, err = ParseArgSpec(spec); err != nil {
+		t.Fatal(err)
+	}
+	bar.Variant = []Variant{*bv}
+	var buf bytes.Buffer
+	if err = l.WriteXML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ReadXML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := r.GetCommandFromPackage(name, "").Variant[0]
+	if got, err := FormatDocumentCommand(read); err != nil || got != def {
+		t.Errorf("after XML round trip: got %q, %v, want %q", got, err, def)
+	}
+	for i, a := range read.Arguments {
+		if a.Name != args[i].Name || a.Type != args[i].Type || a.Optional != args[i].Optional || a.Default != args[i].Default || a.HasDefault != args[i].HasDefault {
+			t.Errorf("after XML round trip: argument %d is %+v, want %+v", i, *a, *args[i])
+		}
+	}
+	if got, err := FormatArgSpec(r.GetCommandFromPackage(`\bar`, "").Variant[0].Arguments); err != nil || got != spec {
+		t.Errorf("after XML round trip: got %q, %v, want %q", got, err, spec)
+	}
+}